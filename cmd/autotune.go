@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/pool"
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	autotuneOp     string
+	startWorkers   int
+	maxWorkers     int
+	increaseBy     int
+	decreaseFactor float64
+	tuneInterval   time.Duration
+	tuneDuration   time.Duration
+	sloP99         time.Duration
+	minGain        float64
+
+	// convergedAfter is the amount of consecutive intervals without improvement after which tuning stops
+	convergedAfter = 3
+
+	autotuneCmd = &cobra.Command{
+		Use:   "autotune",
+		Short: "Find the concurrency with the maximum sustainable throughput",
+		Long: `Runs --op against the objects under --bucketdir in intervals of --interval, adapting the amount of workers after every interval:
+it doubles them while throughput keeps improving (slow start), then adds --increase workers per interval (additive increase) and
+multiplies them by --decrease (multiplicative decrease) when requests get throttled or the --slo-p99 latency is violated.
+Reports the discovered optimum and the concurrency trajectory over time.`,
+		Run: initAutotune,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(autotuneCmd)
+
+	addBucketDirFlags(autotuneCmd, "The location where files are stored in the bucket.")
+	autotuneCmd.Flags().IntVar(&maxFiles, "maxfiles", -1, "Limits the amount of files to work on. Applies after filtering, sampling and --order. -1 is unlimited.")
+	autotuneCmd.Flags().Uint64Var(&bufferSize, "buffersize", 8192, "Buffer size (in bytes) that each worker will use")
+	autotuneCmd.Flags().StringVar(&sampling, "sampling", "cycle", "How files are picked: cycle (in listing order) or random")
+
+	autotuneCmd.Flags().StringVar(&autotuneOp, "op", "get", "Operation to run: get or head")
+	autotuneCmd.Flags().IntVar(&startWorkers, "start-workers", 1, "Amount of workers to start with")
+	autotuneCmd.Flags().IntVar(&maxWorkers, "max-workers", 256, "Maximum amount of workers")
+	autotuneCmd.Flags().IntVar(&increaseBy, "increase", 4, "Workers added after an interval that improved throughput, once slow start is over")
+	autotuneCmd.Flags().Float64Var(&decreaseFactor, "decrease", 0.5, "Factor the workers are multiplied by after an interval with throttled requests or SLO violations")
+	autotuneCmd.Flags().DurationVar(&tuneInterval, "interval", 30*time.Second, "How long to run every interval for")
+	autotuneCmd.Flags().DurationVar(&tuneDuration, "duration", 10*time.Minute, "Maximum time to spend tuning")
+	autotuneCmd.Flags().DurationVar(&sloP99, "slo-p99", 0, "p99 latency above which an interval counts as an SLO violation, e.g. 500ms. 0 disables it.")
+	autotuneCmd.Flags().Float64Var(&minGain, "min-gain", 0.05, "Minimum relative throughput gain for an interval to count as an improvement")
+}
+
+func initAutotune(cmd *cobra.Command, args []string) {
+	sanitizeParams()
+	ctx := cmd.Context()
+
+	var process func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error
+	switch autotuneOp {
+	case "get":
+		process = processDownload
+	case "head":
+		process = processStat
+	default:
+		color.Red("ERROR: Unknown operation [%s], expected get or head.", autotuneOp)
+		os.Exit(1)
+	}
+	if decreaseFactor <= 0 || decreaseFactor >= 1 {
+		color.Red("ERROR: --decrease must be between 0 and 1, got [%f].", decreaseFactor)
+		os.Exit(1)
+	}
+	if maxWorkers < 1 {
+		color.Red("ERROR: --max-workers must be at least 1, got [%d].", maxWorkers)
+		os.Exit(1)
+	}
+
+	// retries within the SDKs turn throttled requests into slow successful ones,
+	// hiding what tuning reacts to
+	if Provider == "gcp" {
+		if sdkRetries {
+			color.Yellow("WARNING: The GCS client retries internally, throttled requests may only show as higher latency.")
+		}
+	} else if !cmd.Flag("sdk-retries").Changed {
+		providerOptions.SDKRetries = false
+		color.Yellow(">>> SDK retries are disabled so that throttled requests get noticed, --sdk-retries enables them.")
+	} else if sdkRetries {
+		color.Yellow("WARNING: SDK retries hide throttled requests from tuning.")
+	}
+
+	files, err := listObjects(ctx)
+	if err != nil {
+		color.Red("ERROR: Unable to list files from bucket: %s, directory: %s. Error: %s.", BucketName, strings.Join(bucketDirs, ","), err)
+		os.Exit(1)
+	}
+	if maxFiles != -1 && len(files) > maxFiles {
+		files = files[:maxFiles]
+	}
+	if len(files) == 0 {
+		color.Red("ERROR: No files found to work on.")
+		os.Exit(1)
+	}
+
+	rows := [][]string{{"Interval", "Elapsed (s)", "Workers", "Ops", "Throttled", "Errors", "Ops/s", "Throughput (MB/s)", "p99 (ms)", "Action"}}
+
+	startTime := time.Now()
+	workers := clampWorkers(startWorkers)
+	slowStart := true
+	best, bestWorkers, bestSummary := -1.0, workers, report.Summary{}
+	noImprovement := 0
+
+	// a single pool is kept busy all along and resized between intervals, so
+	// that intervals don't start cold and wait for the stragglers of the last
+	workerPool, _ := pool.NewPool(pool.Config{NumWorkers: workers})
+	results := &report.Results{}
+	stopFeeding := feedPool(ctx, workerPool, files, process, results)
+
+	from := startTime
+	for interval := 1; time.Since(startTime) < tuneDuration; interval++ {
+		color.Yellow(">>> Autotune interval [%d]: [%d] workers for [%s]", interval, workers, tuneInterval)
+
+		timer := time.NewTimer(tuneInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		// operations count towards the interval they completed in
+		to := time.Now()
+		window := results.Filter(func(m report.MetricRecord) bool {
+			end := m.Start.Add(m.Duration)
+			return !end.Before(from) && end.Before(to)
+		})
+		summary := window.Summarize(to.Sub(from))
+		p99 := window.Percentile(99)
+		from = to
+
+		// byte throughput is what matters for GETs, HEADs don't transfer any
+		throughput := summary.OpsPerSec()
+		if summary.Bytes > 0 {
+			throughput = summary.ThroughputMBps()
+		}
+
+		var action string
+		next := workers
+		switch {
+		case summary.Throttled > 0:
+			action = "throttled, decrease"
+			next = int(float64(workers) * decreaseFactor)
+			slowStart = false
+		case sloP99 > 0 && p99 > sloP99:
+			action = "SLO violated, decrease"
+			next = int(float64(workers) * decreaseFactor)
+			slowStart = false
+		case throughput > best*(1+minGain):
+			best, bestWorkers, bestSummary = throughput, workers, summary
+			noImprovement = 0
+			if slowStart {
+				action = "improved, double"
+				next = workers * 2
+			} else {
+				action = "improved, increase"
+				next = workers + increaseBy
+			}
+		default:
+			action = "no improvement, back to best"
+			next = bestWorkers
+			slowStart = false
+			noImprovement++
+		}
+
+		rows = append(rows, []string{
+			strconv.Itoa(interval),
+			fmt.Sprintf("%.1f", time.Since(startTime).Seconds()),
+			strconv.Itoa(workers),
+			strconv.Itoa(summary.Ops),
+			strconv.Itoa(summary.Throttled),
+			strconv.Itoa(summary.Failures),
+			fmt.Sprintf("%.1f", summary.OpsPerSec()),
+			fmt.Sprintf("%.1f", summary.ThroughputMBps()),
+			fmt.Sprintf("%.1f", millis(p99)),
+			action,
+		})
+
+		if ctx.Err() != nil {
+			color.Red(interruptedNote)
+			break
+		}
+		if noImprovement >= convergedAfter {
+			color.Green(">>> Autotune converged after [%d] intervals without improvement", noImprovement)
+			break
+		}
+
+		next = clampWorkers(next)
+		if next > workers {
+			workerPool.AddWorkers(next - workers)
+		} else if next < workers {
+			workerPool.RemoveWorkers(workers - next)
+		}
+		workers = next
+	}
+
+	stopFeeding()
+	if err := workerPool.Wait(); err != nil {
+		color.Red("ERROR: Closing: %s", err)
+	}
+	color.Green(">>> Threadpool exited\n\n")
+
+	printTable("Autotune trajectory", rows)
+	if best < 0 {
+		color.Red("No interval completed without throttling or SLO violations, no optimum found.")
+		return
+	}
+	color.Green("Discovered optimum: [%d] workers, [%.1f] ops/s, [%.1f] MB/s\n", bestWorkers, bestSummary.OpsPerSec(), bestSummary.ThroughputMBps())
+}
+
+// feedPool keeps p busy running process for objects, picked according to
+// sampling, pushing the records into results. The returned function stops
+// feeding p; tasks still queued by then get skipped.
+func feedPool(ctx context.Context, p *pool.Pool, objects []providers.ObjectInfo, process func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error, results *report.Results) func() {
+	pick := picker(len(objects))
+	feedCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for seq := 0; ; seq++ {
+			obj := objects[pick(seq)]
+			task := func(w *pool.WorkerContext) error {
+				if feedCtx.Err() != nil {
+					return nil
+				}
+				taskCtx, cancel := requestContext(ctx, w)
+				defer cancel()
+				return processTask(w, time.Time{}, func(results *report.Results) error { return process(taskCtx, obj, results) }, results)
+			}
+			if err := p.Add(feedCtx, task); err != nil {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func clampWorkers(workers int) int {
+	if workers < 1 {
+		return 1
+	}
+	if workers > maxWorkers {
+		return maxWorkers
+	}
+	return workers
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dliappis/blobbench/internal/pool"
+	"github.com/dliappis/blobbench/internal/providers"
+)
+
+var (
+	bandwidthLimit       float64
+	workerBandwidthLimit float64
+
+	workerLimitersMu sync.Mutex
+	workerLimiters   = map[int]*providers.Limiter{}
+)
+
+// withWorkerLimiter applies the bandwidth limit of worker w to the transfers made with ctx
+func withWorkerLimiter(ctx context.Context, w *pool.WorkerContext) context.Context {
+	if workerBandwidthLimit <= 0 || w == nil {
+		return ctx
+	}
+
+	workerLimitersMu.Lock()
+	defer workerLimitersMu.Unlock()
+
+	l, ok := workerLimiters[w.ID]
+	if !ok {
+		l = providers.NewLimiter(workerBandwidthLimit * 1024 * 1024)
+		workerLimiters[w.ID] = l
+	}
+	return providers.WithLimiter(ctx, l)
+}
+
+// bandwidthLimits describes the bandwidth limits in use, if any
+func bandwidthLimits() string {
+	if bandwidthLimit <= 0 && workerBandwidthLimit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nBandwidth limit (MB/s): [%s total, %s per worker]", describeLimit(bandwidthLimit), describeLimit(workerBandwidthLimit))
+}
+
+func describeLimit(limit float64) string {
+	if limit <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%.1f", limit)
+}
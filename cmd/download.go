@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,13 +14,15 @@ import (
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
-	"github.com/dliappis/blobbench/internal/pool"
 	"github.com/dliappis/blobbench/internal/providers"
 	"github.com/dliappis/blobbench/internal/report"
 )
 
 var (
+	// bucketDir is the first of bucketDirs, where objects get written
 	bucketDir  string
+	bucketDirs []string
+	recursive  bool
 	maxFiles   int
 	numWorkers int
 	bufferSize uint64
@@ -36,164 +39,253 @@ func init() {
 	rootCmd.AddCommand(downloadCmd)
 
 	// FIXME; can I use a callback to add a slash to bucketdir?
-	downloadCmd.Flags().StringVar(&bucketDir, "bucketdir", "", "The location where files are stored in the bucket.")
-	downloadCmd.MarkFlagRequired("bucketdir")
-	downloadCmd.Flags().IntVar(&maxFiles, "maxfiles", -1, "Limits the amount of files to download. The order is undefined. -1 is unlimited.")
+	addBucketDirFlags(downloadCmd, "The location where files are stored in the bucket.")
+	downloadCmd.Flags().IntVar(&maxFiles, "maxfiles", -1, "Limits the amount of files to download. Applies after filtering, sampling and --order. -1 is unlimited.")
 
 	downloadCmd.Flags().IntVar(&numWorkers, "workers", 5, "Amount of parallel download workers")
 	downloadCmd.Flags().Uint64Var(&bufferSize, "buffersize", 8192, "Buffer size (in bytes) that each worker will use")
+
+	addRunLengthFlags(downloadCmd)
+	addWarmupFlags(downloadCmd)
+	addRateFlags(downloadCmd)
+	addRampFlags(downloadCmd)
+	addHedgeFlags(downloadCmd)
+	addPartsFlags(downloadCmd)
+}
+
+// addBucketDirFlags adds the flags selecting the objects to list
+func addBucketDirFlags(cmd *cobra.Command, usage string) {
+	cmd.Flags().StringSliceVar(&bucketDirs, "bucketdir", nil, usage+" Can be repeated, or comma separated, to work on the objects under several prefixes.")
+	cmd.Flags().BoolVar(&recursive, "recursive", false, "Lists the objects in nested directories under --bucketdir too, instead of only its direct children")
+	cmd.Flags().StringVar(&keysFrom, "keys-from", "", "Reads the objects to work on from a file instead of listing --bucketdir: a JSON manifest (.json), key,size[,md5] lines (.csv) or one key per line")
+	addSelectionFlags(cmd)
 }
 
 func initDownload(cmd *cobra.Command, args []string) {
 	sanitizeParams()
 
-	startTime := time.Now()
-	color.Green(">>> Threadpool started")
-
-	pool, _ := pool.NewPool(pool.Config{NumWorkers: numWorkers})
-	results := &report.Results{}
-
-	files, err := listObjects()
+	files, err := listObjects(cmd.Context())
 	if err != nil {
-		color.Red("ERROR: Unable to list files from bucket: %s, directory: %s. Error: %s.", BucketName, bucketDir, err)
+		color.Red("ERROR: Unable to list files from bucket: %s, directory: %s. Error: %s.", BucketName, strings.Join(bucketDirs, ","), err)
 		os.Exit(1)
 	}
 
-	fmt.Println(files)
-	for idx, file := range files {
-		if maxFiles != -1 && idx+1 > maxFiles {
-			break
-		}
-
-		ctx := context.Background()
-		var err error
-		var task func()
-		key := file
-
-		task = func() {
-			// ----- TaskFunc definition -------------------------------
-			err = processDownload(key, results)
-			// ---------------------------------------------------------
-
-			if err != nil {
-				color.Red("ERROR: ", err)
-			}
-		}
-
-		if err := pool.Add(ctx, task); err != nil {
-			color.Red("ERROR: Adding item: %s", err)
-			os.Exit(1)
-		}
+	color.Green(">>> Working on [%d] objects", len(files))
+	if downloadParts != 1 || partsCompare {
+		printResults(runParts(cmd.Context(), files, processDownload))
+		return
 	}
-
-	if err := pool.Wait(); err != nil {
-		color.Red("ERROR: Closing: %s", err)
+	if hedging() || hedgeCompare {
+		printResults(runHedged(cmd.Context(), files, processDownload))
+		return
 	}
-
-	color.Green(">>> Threadpool exited\n\n")
-
-	duration := time.Since(startTime)
-	printResults(results, duration)
+	printResults(runKeys(cmd.Context(), files, processDownload))
 }
 
-func processDownload(key string, results *report.Results) error {
+func processDownload(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error {
 	switch Provider {
 	case "dummy":
 		p := &providers.Dummy{
-			Results: results,
-			Key:     key,
+			Options:    providerOptions,
+			BufferSize: bufferSize,
+			Results:    results,
+			Key:        obj.Key,
+			Object:     obj,
 		}
-		return p.Download()
+		return download(ctx, p)
 	case "aws":
 		p := &providers.S3{
-			S3Client:   s3.New(providers.SetupS3Client(Region)),
+			Options:    providerOptions,
+			S3Client:   s3.New(providers.SetupS3Client(Region, providerOptions)),
 			BufferSize: bufferSize,
 			Results:    results,
 			BucketName: BucketName,
 			BucketDir:  bucketDir,
-			Key:        key,
+			Key:        obj.Key,
+			Object:     obj,
 		}
-		return p.Download()
+		return download(ctx, p)
 	case "gcp":
 		p := &providers.GCS{
+			Options:    providerOptions,
 			GCSClient:  providers.SetupGCSClient(),
 			BufferSize: bufferSize,
 			Results:    results,
 			BucketName: BucketName,
 			BucketDir:  bucketDir,
-			Key:        key,
+			Key:        obj.Key,
+			Object:     obj,
 		}
-		return p.Download()
+		return download(ctx, p)
 	case "azure":
 		p := &providers.AZBlob{
-			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY")),
+			Options:    providerOptions,
+			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
 			BufferSize: bufferSize,
 			Results:    results,
 			BucketName: BucketName,
 			BucketDir:  bucketDir,
-			Key:        key,
+			Key:        obj.Key,
+			Object:     obj,
 		}
-		return p.Download()
+		return download(ctx, p)
 
 	}
 	return fmt.Errorf("Unknown provider %s", Provider)
 }
 
-func listObjects() ([]string, error) {
+// listObjects lists the objects under all bucketDirs, or reads them from
+// keysFrom, and returns the selected ones, up to maxFiles of them.
+func listObjects(ctx context.Context) ([]providers.ObjectInfo, error) {
+	if keysFrom != "" {
+		return keysFromFile()
+	}
+	if len(bucketDirs) == 0 {
+		return nil, fmt.Errorf("either --bucketdir or --keys-from is required")
+	}
+
+	var objects []providers.ObjectInfo
+	seen := map[string]bool{}
+	for _, dir := range bucketDirs {
+		// selections need the full listing
+		remaining := -1
+		if maxFiles != -1 && !selecting() {
+			remaining = maxFiles - len(objects)
+			if remaining <= 0 {
+				break
+			}
+		}
+
+		listed, err := listObjectInfos(ctx, dir, remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range listed {
+			// prefixes overlap when one is nested in another
+			if !seen[obj.Key] {
+				seen[obj.Key] = true
+				obj.Source = "listing"
+				objects = append(objects, obj)
+			}
+		}
+	}
+	if selecting() {
+		objects = selectObjects(objects)
+	}
+	return objects, nil
+}
+
+// keysFromFile returns the selected objects of keysFrom, up to maxFiles of them
+func keysFromFile() ([]providers.ObjectInfo, error) {
+	objects, err := readKeys(keysFrom)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keys from [%s]: %s", keysFrom, err)
+	}
+
+	for i := range objects {
+		objects[i].Source = "keys file"
+	}
+	if selecting() {
+		objects = selectObjects(objects)
+	} else if maxFiles != -1 && len(objects) > maxFiles {
+		objects = objects[:maxFiles]
+	}
+	return objects, nil
+}
+
+func listObjectInfos(ctx context.Context, dir string, maxFiles int) ([]providers.ObjectInfo, error) {
 	switch Provider {
+	case "dummy":
+		p := &providers.Dummy{
+			Options:   providerOptions,
+			BucketDir: dir,
+		}
+		return p.ListObjects(ctx, maxFiles)
 	case "aws":
 		p := &providers.S3{
-			S3Client:   s3.New(providers.SetupS3Client(Region)),
+			Options:    providerOptions,
+			S3Client:   s3.New(providers.SetupS3Client(Region, providerOptions)),
 			BucketName: BucketName,
-			BucketDir:  bucketDir,
+			BucketDir:  dir,
 		}
-		return p.ListObjects(maxFiles)
+		return p.ListObjects(ctx, maxFiles)
 	case "gcp":
 		p := &providers.GCS{
+			Options:    providerOptions,
 			GCSClient:  providers.SetupGCSClient(),
 			BucketName: BucketName,
-			BucketDir:  bucketDir,
+			BucketDir:  dir,
 		}
-		return p.ListObjects(maxFiles)
+		return p.ListObjects(ctx, maxFiles)
 	case "azure":
 		p := &providers.AZBlob{
-			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY")),
+			Options:    providerOptions,
+			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
 			BucketName: BucketName,
-			BucketDir:  bucketDir,
+			BucketDir:  dir,
 		}
-		return p.ListObjects(maxFiles)
+		return p.ListObjects(ctx, maxFiles)
 	}
 	return nil, nil
 }
 
-func printResults(results *report.Results, duration time.Duration) {
-	sort.Sort(report.ByDuration(results.Items()))
+func printResults(out runOutcome) {
+	sort.Sort(report.ByDuration(out.results.Items()))
 	if OutputFile == "" {
-		printResultsStdout(results, duration)
+		printResultsStdout(out)
 	} else {
-		printResultsFile(results, duration)
+		printResultsFile(out)
 	}
 }
 
-func printResultsStdout(results *report.Results, duration time.Duration) {
+func printResultsStdout(out runOutcome) {
+	results, duration := out.results, out.duration
+
 	color.Yellow("\nResults following\n")
 	color.Yellow(strings.Repeat("-", 90))
 
 	color.Green(resultsHeader())
-	color.Green("\nSample|File|Duration (ms)|Size (MB)|Success|Err Code|Err Message")
+	if out.interrupted {
+		color.Red(interruptedNote)
+	}
+	color.Green("\nSample|File|Op|Duration (ms)|Size (MB)|Object Size (MB)|Success|Err Class|HTTP Status|Err Code|Err Message|Worker|Queue Wait (ms)|Attempts|Attempt Errors|Stalls|Resumes")
 	sort.Sort(report.ByDuration(results.Items()))
 	for idx, v := range results.Items() {
-		color.Green("%d|%s|%.1f|%.1f|%t|%s|%s", idx, v.File, float64(v.Duration/time.Millisecond), float64(v.Size/1024), v.Success, v.ErrDetails.Code, v.ErrDetails.Message)
+		color.Green("%d|%s|%s|%.1f|%.1f|%.1f|%t|%s|%d|%s|%s|%d|%.1f|%d|%s|%d|%d", idx, sampleName(v), v.Op, float64(v.Duration/time.Millisecond), float64(v.Size/1024), float64(v.ObjectSize)/1024/1024, v.Success, v.ErrDetails.Class, v.ErrDetails.Status, v.ErrDetails.Code, v.ErrDetails.Message, v.Worker, millis(v.QueueWait), v.Attempts, attemptErrors(v), v.Stalls, v.Resumes)
 	}
 	color.Green(summaryOfResults(results, duration))
+	for _, op := range opsOf(results) {
+		color.Green("\nOperation [%s]:%s", op, summaryOfResults(results.Filter(isOp(op)), duration))
+	}
+	if out.workers != nil {
+		color.Green("%s", workerSummary(out))
+	}
+	if out.ramp != nil {
+		color.Green("%s", rampTimeline(out))
+	}
+	if out.hedged {
+		color.Green("%s", hedgingSummary(out))
+	}
+	if out.parts > 0 {
+		color.Green("%s", partsSummary(out))
+	}
+	if readStats {
+		color.Green("%s", readAnalysis(results))
+	}
+	if out.warmup != nil {
+		color.Yellow("\nWarm-up (excluded from the results above):%s", summaryOfResults(out.warmup, out.warmupDuration))
+	}
 	fmt.Println()
 }
 
-func printResultsFile(results *report.Results, duration time.Duration) {
+func printResultsFile(out runOutcome) {
+	results, duration := out.results, out.duration
+
 	f, err := os.Create(OutputFile)
 	if err != nil {
 		color.Red("Unable to write to [%s], err [%s]. Printing to stdout instead.", OutputFile, err)
-		printResultsStdout(results, duration)
+		printResultsStdout(out)
 	}
 	defer f.Close()
 
@@ -202,41 +294,150 @@ func printResultsFile(results *report.Results, duration time.Duration) {
 	_, err = fmt.Fprintf(w, resultsHeader())
 	checkWriteErr(err)
 
-	_, err = fmt.Fprintf(w, "\nSample|File|Duration (ms)|Size (MB)|Throughput (MB/s)|Throughput (Mbps)|Success|Err Code|Err Message\n")
+	if out.interrupted {
+		_, err = fmt.Fprintf(w, interruptedNote+"\n")
+		checkWriteErr(err)
+	}
+
+	_, err = fmt.Fprintf(w, "\nSample|File|Op|Duration (ms)|Size (MB)|Object Size (MB)|Throughput (MB/s)|Throughput (Mbps)|Success|Err Class|HTTP Status|Err Code|Err Message|Worker|Queue Wait (ms)|Attempts|Attempt Errors|Stalls|Resumes\n")
 	checkWriteErr(err)
 
 	for idx, v := range results.Items() {
-		_, err = fmt.Fprintf(w, "%d|%s|%.1f|%.1f|%.1f|%.1f|%t|%s|%s\n", idx, v.File, float64(v.Duration/time.Millisecond), float64(v.Size/1024/1024), float64(v.Size*1000/1024/1024)/float64(v.Duration/time.Millisecond), float64(v.Size*8*1000/1024/1024)/float64(v.Duration/time.Millisecond), v.Success, v.ErrDetails.Code, v.ErrDetails.Message)
+		_, err = fmt.Fprintf(w, "%d|%s|%s|%.1f|%.1f|%.1f|%.1f|%.1f|%t|%s|%d|%s|%s|%d|%.1f|%d|%s|%d|%d\n", idx, sampleName(v), v.Op, float64(v.Duration/time.Millisecond), float64(v.Size/1024/1024), float64(v.ObjectSize)/1024/1024, float64(v.Size*1000/1024/1024)/float64(v.Duration/time.Millisecond), float64(v.Size*8*1000/1024/1024)/float64(v.Duration/time.Millisecond), v.Success, v.ErrDetails.Class, v.ErrDetails.Status, v.ErrDetails.Code, v.ErrDetails.Message, v.Worker, millis(v.QueueWait), v.Attempts, attemptErrors(v), v.Stalls, v.Resumes)
 		checkWriteErr(err)
 	}
 
 	_, err = fmt.Fprintf(w, summaryOfResults(results, duration))
 	checkWriteErr(err)
+
+	for _, op := range opsOf(results) {
+		_, err = fmt.Fprintf(w, "\nOperation [%s]:%s", op, summaryOfResults(results.Filter(isOp(op)), duration))
+		checkWriteErr(err)
+	}
+
+	if out.workers != nil {
+		_, err = fmt.Fprint(w, workerSummary(out))
+		checkWriteErr(err)
+	}
+
+	if out.ramp != nil {
+		_, err = fmt.Fprint(w, rampTimeline(out))
+		checkWriteErr(err)
+	}
+
+	if out.hedged {
+		_, err = fmt.Fprint(w, hedgingSummary(out))
+		checkWriteErr(err)
+	}
+
+	if out.parts > 0 {
+		_, err = fmt.Fprint(w, partsSummary(out))
+		checkWriteErr(err)
+	}
+
+	if readStats {
+		_, err = fmt.Fprint(w, readAnalysis(results))
+		checkWriteErr(err)
+	}
+
+	if out.warmup != nil {
+		_, err = fmt.Fprintf(w, "\nWarm-up (excluded from the results above):%s", summaryOfResults(out.warmup, out.warmupDuration))
+		checkWriteErr(err)
+	}
 	w.Flush()
 }
 
+// interruptedNote marks the report of a run that got interrupted
+const interruptedNote = "INTERRUPTED: the run was stopped before its end, results are partial."
+
 func resultsHeader() string {
-	return fmt.Sprintf("\nMax files: [%d], Number of workers: [%d], Buffer size: [%d]\n", maxFiles, numWorkers, bufferSize)
+	return fmt.Sprintf("\nMax files: [%d], Number of workers: [%d], Buffer size: [%d], Duration: [%s], Total ops: [%d], Warm-up: [%s / %d ops], Rate: [%.1f ops/s, %s]\n", maxFiles, numWorkers, bufferSize, runDuration, totalOps, warmupDuration, warmupOps, rate, arrival)
 }
 
 func summaryOfResults(results *report.Results, duration time.Duration) string {
-	var totalBytesDownloaded uint64
+	summary := results.Summarize(duration)
+	totalBytesDownloaded := summary.Bytes
+	totalFiles := summary.Ops
 
-	for _, v := range results.Items() {
-		totalBytesDownloaded += uint64(v.Size)
+	thoughputMBps := summary.ThroughputMBps()
+	opsPerSec := summary.OpsPerSec()
+	sumLine := fmt.Sprintf(
+		"\nTotals:\n"+
+			"Execution Time (human)|Execution Time (ms)|Bytes Transferred|GB Transferred|Throughput (MB/s)|Throughput (Gbps)|Workers|Number of Files|BufferSize (B)|Ops/s\n"+
+			"%s|%.1f|%d|%.1f|%.1f|%.1f|%d|%d|%d|%.1f", duration, float64(duration)/float64(time.Millisecond), totalBytesDownloaded, float64(totalBytesDownloaded)/float64(1024*1024*1024), thoughputMBps, float64(thoughputMBps)*8.0/1024.0, numWorkers, totalFiles, bufferSize, opsPerSec)
+
+	if summary.Failures > 0 {
+		sumLine += "\nErrors by class:\n" + strings.Join(report.ErrorClasses, "|") + "\n"
+		counts := make([]string, 0, len(report.ErrorClasses))
+		for _, class := range report.ErrorClasses {
+			counts = append(counts, strconv.Itoa(summary.Errors[class]))
+		}
+		sumLine += strings.Join(counts, "|")
 	}
 
-	totalFiles := len(results.Items())
+	sumLine += bandwidthLimits()
 
-	thoughputMBps := float64(totalBytesDownloaded) / ((float64(duration) / float64(time.Millisecond)) * float64(1000))
-	sumLine := fmt.Sprintf(
-		"\nTotals:\n"+
-			"Execution Time (human)|Execution Time (ms)|Bytes Downloaded|GB Downloaded|Throughput (MB/s)|Throughput (Gbps)|Workers|Number of Files|BufferSize (B)\n"+
-			"%s|%.1f|%d|%.1f|%.1f|%.1f|%d|%d|%d", duration, float64(duration)/float64(time.Millisecond), totalBytesDownloaded, float64(totalBytesDownloaded)/float64(1024*1024*1024), thoughputMBps, float64(thoughputMBps)*8.0/1024.0, numWorkers, totalFiles, bufferSize)
+	if summary.ThinkTime > 0 && summary.Busy > 0 {
+		sumLine += fmt.Sprintf("\nThink time (s): [%.1f], share of the duration of successful operations: [%.1f%%]", summary.ThinkTime.Seconds(), float64(summary.ThinkTime)*100/float64(summary.Busy))
+	}
+
+	if summary.ListedBytes > 0 {
+		sumLine += fmt.Sprintf("\nListed size of the downloaded objects (MB): [%.1f], transferred: [%.1f%%]", float64(summary.ListedBytes)/1024/1024, float64(summary.ListedRead)*100/float64(summary.ListedBytes))
+	}
+
+	sumLine += verificationSummary(summary)
+
+	if summary.Retried > 0 {
+		sumLine += fmt.Sprintf("\nRetried operations: [%d], extra attempts: [%d]", summary.Retried, summary.Retries)
+	}
+
+	if summary.Stalled > 0 {
+		sumLine += fmt.Sprintf("\nStalled operations: [%d], stalls: [%d], resumed: [%d]", summary.Stalled, summary.Stalls, summary.Resumes)
+	}
+
+	sumLine += fmt.Sprintf(
+		"\nLatency of successful requests (ms):\n"+
+			"p50|p90|p99|p99.9|Max\n"+
+			"%.1f|%.1f|%.1f|%.1f|%.1f\n", millis(results.Percentile(50)), millis(results.Percentile(90)), millis(results.Percentile(99)), millis(results.Percentile(99.9)), millis(results.Percentile(100)))
 
 	return sumLine
 }
 
+// opsOf returns the operation types of results when there is more than one,
+// so that each one can get its own report section.
+func opsOf(results *report.Results) []string {
+	ops := results.Ops()
+	if len(ops) < 2 {
+		return nil
+	}
+	return ops
+}
+
+func isOp(op string) func(report.MetricRecord) bool {
+	return func(m report.MetricRecord) bool { return m.Op == op }
+}
+
+// sampleName identifies the object of a sample, along with its byte range for range reads
+func sampleName(m report.MetricRecord) string {
+	if m.Op == report.OpGetRange {
+		return fmt.Sprintf("%s [%d+%d]", m.File, m.Offset, m.Length)
+	}
+	return m.File
+}
+
+// attemptErrors lists the class and code of the errors of retried attempts of m
+func attemptErrors(m report.MetricRecord) string {
+	errs := make([]string, 0, len(m.AttemptErrors))
+	for _, e := range m.AttemptErrors {
+		errs = append(errs, fmt.Sprintf("%s:%s", e.Class, e.Code))
+	}
+	return strings.Join(errs, ";")
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func checkWriteErr(err error) {
 	if err != nil {
 		panic(err)
@@ -244,7 +445,12 @@ func checkWriteErr(err error) {
 }
 
 func sanitizeParams() {
-	if bucketDir[len(bucketDir)-1:] != "/" {
-		bucketDir = bucketDir + "/"
+	for i, dir := range bucketDirs {
+		if !strings.HasSuffix(dir, "/") {
+			bucketDirs[i] = dir + "/"
+		}
+	}
+	if len(bucketDirs) > 0 {
+		bucketDir = bucketDirs[0]
 	}
 }
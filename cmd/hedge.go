@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	hedgeAfter      time.Duration
+	hedgePercentile float64
+	hedgeCompare    bool
+)
+
+// addHedgeFlags adds the flags that hedge GET requests.
+func addHedgeFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&hedgeAfter, "hedge-after", 0, "Issues a duplicate GET when a request hasn't completed after this long, e.g. 200ms. 0 disables hedging unless --hedge-percentile is set.")
+	cmd.Flags().Float64Var(&hedgePercentile, "hedge-percentile", 0, "Issues a duplicate GET when a request takes longer than this percentile of the observed latency, e.g. 95. --hedge-after applies until enough requests have been observed.")
+	cmd.Flags().BoolVar(&hedgeCompare, "hedge-compare", false, "Runs the workload without hedging first, to compare its latency with the hedged run")
+}
+
+func hedging() bool {
+	return hedgeAfter > 0 || hedgePercentile > 0
+}
+
+// runHedged runs objects with hedging enabled and, with --hedge-compare, once
+// more without hedging beforehand, keeping the results as a baseline.
+func runHedged(ctx context.Context, objects []providers.ObjectInfo, process func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error) runOutcome {
+	if hedgePercentile < 0 || hedgePercentile > 100 {
+		color.Red("ERROR: --hedge-percentile must be between 0 and 100, got [%f].", hedgePercentile)
+		os.Exit(1)
+	}
+	if hedgeCompare && !hedging() {
+		color.Red("ERROR: --hedge-compare requires --hedge-after or --hedge-percentile.")
+		os.Exit(1)
+	}
+
+	out := runCompared(ctx, objects, process, "hedging", hedgeCompare, func() {
+		providerOptions.Hedger = providers.NewHedger(hedgeAfter, hedgePercentile)
+	}, func() {
+		providerOptions.Hedger = nil
+	})
+	// an interrupted comparison only has the run without hedging
+	out.hedged = out.baseline != nil || !hedgeCompare
+	return out
+}
+
+// hedgingSummary compares the hedged run with its baseline, if there is one.
+func hedgingSummary(out runOutcome) string {
+	summary := "\nHedging:\n" +
+		"Run|Ops|Requests|Extra Requests (%)|Hedged|Hedges Won|p50 (ms)|p90 (ms)|p99 (ms)|p99.9 (ms)|Max (ms)\n"
+
+	if out.baseline != nil {
+		summary += hedgingRow("without hedging", out.baseline, out.baselineDuration)
+	}
+	summary += hedgingRow("with hedging", out.results, out.duration)
+	return summary
+}
+
+func hedgingRow(name string, results *report.Results, duration time.Duration) string {
+	s := results.Summarize(duration)
+
+	var extra float64
+	if s.Ops > 0 {
+		extra = float64(s.Requests()-s.Ops) * 100 / float64(s.Ops)
+	}
+	return fmt.Sprintf("%s|%d|%d|%.1f|%d|%d|%.1f|%.1f|%.1f|%.1f|%.1f\n", name, s.Ops, s.Requests(), extra, s.Hedged, s.HedgeWins,
+		millis(results.Percentile(50)), millis(results.Percentile(90)), millis(results.Percentile(99)), millis(results.Percentile(99.9)), millis(results.Percentile(100)))
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dliappis/blobbench/internal/providers"
+)
+
+var keysFrom string
+
+// manifestEntry is an object of a JSON manifest
+type manifestEntry struct {
+	Key  string `json:"key"`
+	Size *int64 `json:"size"`
+	MD5  string `json:"md5"`
+}
+
+// readKeys reads the objects to work on from a file instead of listing them:
+// a JSON manifest with a .json extension, key,size[,md5] lines with a .csv
+// extension, or one key per line otherwise. Sizes are -1 when not known.
+func readKeys(path string) ([]providers.ObjectInfo, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return readKeysJSON(path)
+	case ".csv":
+		return readKeysCSV(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objects []providers.ObjectInfo
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key := strings.TrimSpace(s.Text())
+		if key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		objects = append(objects, providers.ObjectInfo{Key: key, Size: -1})
+	}
+	return objects, s.Err()
+}
+
+// readKeysJSON reads a JSON array of {"key", "size", "md5"} objects, of which only the key is required
+func readKeysJSON(path string) ([]providers.ObjectInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var manifest []manifestEntry
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, err
+	}
+
+	objects := make([]providers.ObjectInfo, 0, len(manifest))
+	for _, m := range manifest {
+		if m.Key == "" {
+			return nil, fmt.Errorf("object without a key in manifest")
+		}
+		obj := providers.ObjectInfo{Key: m.Key, Size: -1}
+		if m.Size != nil {
+			obj.Size = *m.Size
+		}
+		if obj.MD5, err = parseMD5(m.MD5, m.Key); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// readKeysCSV reads key,size[,md5] lines, with the MD5 in hex
+func readKeysCSV(path string) ([]providers.ObjectInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+
+	var objects []providers.ObjectInfo
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("expected key,size[,md5] but got [%d] fields for [%s]", len(record), record[0])
+		}
+
+		obj := providers.ObjectInfo{Key: record[0]}
+		if obj.Size, err = strconv.ParseInt(record[1], 10, 64); err != nil || obj.Size < 0 {
+			return nil, fmt.Errorf("invalid size [%s] of [%s]", record[1], record[0])
+		}
+		if len(record) == 3 {
+			if obj.MD5, err = parseMD5(record[2], record[0]); err != nil {
+				return nil, err
+			}
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// writeManifest writes entries as a JSON manifest that readKeys reads back
+func writeManifest(path string, entries []manifestEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseMD5 decodes the hex MD5 of key, if any
+func parseMD5(s, key string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	sum, err := hex.DecodeString(s)
+	if err != nil || len(sum) != md5.Size {
+		return nil, fmt.Errorf("invalid md5 [%s] of [%s]", s, key)
+	}
+	return sum, nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dliappis/blobbench/internal/providers"
+)
+
+func TestReadKeys(t *testing.T) {
+	sum := []byte{0x73, 0xd7, 0xee, 0x67, 0x3b, 0xc5, 0x6f, 0xe6, 0x57, 0xe2, 0xc1, 0x43, 0xa0, 0xbd, 0x5d, 0x57}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []providers.ObjectInfo
+		wantErr bool
+	}{
+		{
+			name:    "plain",
+			file:    "keys.txt",
+			content: "# objects\ndir/a\n\n  dir/b  \n",
+			want:    []providers.ObjectInfo{{Key: "dir/a", Size: -1}, {Key: "dir/b", Size: -1}},
+		},
+		{
+			name:    "csv",
+			file:    "keys.csv",
+			content: "dir/a,10\ndir/b,20,73d7ee673bc56fe657e2c143a0bd5d57\n",
+			want:    []providers.ObjectInfo{{Key: "dir/a", Size: 10}, {Key: "dir/b", Size: 20, MD5: sum}},
+		},
+		{name: "csv without size", file: "keys.csv", content: "dir/a\n", wantErr: true},
+		{name: "csv negative size", file: "keys.csv", content: "dir/a,-1\n", wantErr: true},
+		{name: "csv bad md5", file: "keys.csv", content: "dir/a,1,abc\n", wantErr: true},
+		{
+			name:    "json",
+			file:    "keys.json",
+			content: `[{"key": "dir/a"}, {"key": "dir/b", "size": 0, "md5": "73d7ee673bc56fe657e2c143a0bd5d57"}]`,
+			want:    []providers.ObjectInfo{{Key: "dir/a", Size: -1}, {Key: "dir/b", Size: 0, MD5: sum}},
+		},
+		{name: "json without key", file: "keys.json", content: `[{"size": 1}]`, wantErr: true},
+		{name: "json malformed", file: "keys.json", content: `{"key": "dir/a"}`, wantErr: true},
+	}
+
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readKeys(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readKeys() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	size := int64(4096)
+	path := filepath.Join(dir, "manifest.json")
+	entries := []manifestEntry{{Key: "dir/object-00000000", Size: &size, MD5: "73d7ee673bc56fe657e2c143a0bd5d57"}}
+	if err := writeManifest(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Key != "dir/object-00000000" || got[0].Size != size || len(got[0].MD5) != 16 {
+		t.Errorf("read back %+v", got)
+	}
+}
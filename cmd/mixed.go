@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+	"github.com/dliappis/blobbench/internal/workload"
+)
+
+var (
+	mixSpec string
+	numOps  int
+
+	mixedCmd = &cobra.Command{
+		Use:   "mixed",
+		Short: "Run a weighted mix of GET, HEAD, PUT, LIST and DELETE operations against a Bucket",
+		Long: `Runs --ops operations against the objects under --bucketdir, picking each one randomly according to the weights of --mix.
+GETs and HEADs target the listed objects, PUTs write new objects under <bucketdir>blobbench-mixed/,
+DELETEs remove objects written by earlier PUTs of the same run and LISTs list <bucketdir>.`,
+		Run: initMixed,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(mixedCmd)
+
+	addBucketDirFlags(mixedCmd, "The location where files are stored in the bucket.")
+	mixedCmd.MarkFlagRequired("bucketdir")
+	mixedCmd.Flags().IntVar(&maxFiles, "maxfiles", -1, "Limits the amount of files to read from. Applies after filtering, sampling and --order. -1 is unlimited.")
+
+	mixedCmd.Flags().StringVar(&mixSpec, "mix", "get=70,put=20,list=5,delete=5", "Weights of the operations (get, head, put, list, delete) to run")
+	mixedCmd.Flags().IntVar(&numOps, "ops", 1000, "Total amount of operations to run")
+	mixedCmd.Flags().IntVar(&objectSize, "objectsize", 4096, "Size (in bytes) of each object written by PUT operations")
+
+	mixedCmd.Flags().IntVar(&numWorkers, "workers", 5, "Amount of parallel workers")
+	mixedCmd.Flags().Uint64Var(&bufferSize, "buffersize", 8192, "Buffer size (in bytes) that each worker will use")
+
+	addWarmupFlags(mixedCmd)
+	addRateFlags(mixedCmd)
+	addRampFlags(mixedCmd)
+}
+
+// writtenKeys keeps track of the objects written by a mixed run, so that
+// DELETE operations never remove objects that were there before the run.
+type writtenKeys struct {
+	sync.Mutex
+	keys []string
+}
+
+func (w *writtenKeys) push(key string) {
+	w.Lock()
+	defer w.Unlock()
+	w.keys = append(w.keys, key)
+}
+
+func (w *writtenKeys) pop() (string, bool) {
+	w.Lock()
+	defer w.Unlock()
+	if len(w.keys) == 0 {
+		return "", false
+	}
+	key := w.keys[len(w.keys)-1]
+	w.keys = w.keys[:len(w.keys)-1]
+	return key, true
+}
+
+func initMixed(cmd *cobra.Command, args []string) {
+	sanitizeParams()
+
+	if numOps < 1 {
+		color.Red("ERROR: --ops must be at least 1, got [%d].", numOps)
+		os.Exit(1)
+	}
+	if objectSize < 0 {
+		color.Red("ERROR: --objectsize can't be negative, got [%d].", objectSize)
+		os.Exit(1)
+	}
+
+	mix, err := workload.ParseMix(mixSpec)
+	if err != nil {
+		color.Red("ERROR: %s", err)
+		os.Exit(1)
+	}
+	color.Green(">>> Workload mix: %s", mix)
+
+	files, err := listObjects(cmd.Context())
+	if err != nil {
+		color.Red("ERROR: Unable to list files from bucket: %s, directory: %s. Error: %s.", BucketName, strings.Join(bucketDirs, ","), err)
+		os.Exit(1)
+	}
+
+	body := make([]byte, objectSize)
+	rand.Read(body)
+
+	// ops are picked upfront so that the pool workers don't contend on a shared source
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ops := make([]string, numOps)
+	reads := make([]providers.ObjectInfo, numOps)
+	for i := range ops {
+		ops[i] = mix.Pick(rnd)
+		if (ops[i] == report.OpGet || ops[i] == report.OpHead) && len(files) > 0 {
+			reads[i] = files[rnd.Intn(len(files))]
+		}
+	}
+
+	putPrefix := fmt.Sprintf("%sblobbench-mixed/%d-", bucketDir, time.Now().UnixNano())
+	written := &writtenKeys{}
+
+	out := runTasks(cmd.Context(), numOps, func(ctx context.Context, seq int, results *report.Results) error {
+		// warm-up tasks make sequence numbers go beyond numOps, they replay the schedule
+		op, read := ops[seq%numOps], reads[seq%numOps]
+
+		switch op {
+		case report.OpGet, report.OpHead:
+			if read.Key == "" {
+				return fmt.Errorf("No objects found under [%s] to %s", bucketDir, op)
+			}
+			if op == report.OpGet {
+				return processDownload(ctx, read, results)
+			}
+			return processStat(ctx, read, results)
+		case report.OpList:
+			return processList(ctx, results)
+		case report.OpDelete:
+			if key, ok := written.pop(); ok {
+				return processDelete(ctx, key, results)
+			}
+			// nothing written yet, fall back to a PUT so that the run keeps its pace
+		}
+
+		key := fmt.Sprintf("%s%08d", putPrefix, seq)
+		err := processPut(ctx, key, body, results)
+		if err == nil {
+			written.push(key)
+		}
+		return err
+	})
+	printResults(out)
+}
+
+func processList(ctx context.Context, results *report.Results) error {
+	switch Provider {
+	case "dummy":
+		p := &providers.Dummy{
+			Options:   providerOptions,
+			Results:   results,
+			BucketDir: bucketDir,
+		}
+		return p.List(ctx)
+	case "aws":
+		p := &providers.S3{
+			Options:    providerOptions,
+			S3Client:   s3.New(providers.SetupS3Client(Region, providerOptions)),
+			Results:    results,
+			BucketName: BucketName,
+			BucketDir:  bucketDir,
+		}
+		return p.List(ctx)
+	case "gcp":
+		p := &providers.GCS{
+			Options:    providerOptions,
+			GCSClient:  providers.SetupGCSClient(),
+			Results:    results,
+			BucketName: BucketName,
+			BucketDir:  bucketDir,
+		}
+		return p.List(ctx)
+	case "azure":
+		p := &providers.AZBlob{
+			Options:    providerOptions,
+			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
+			Results:    results,
+			BucketName: BucketName,
+			BucketDir:  bucketDir,
+		}
+		return p.List(ctx)
+	}
+	return fmt.Errorf("Unknown provider %s", Provider)
+}
+
+func processDelete(ctx context.Context, key string, results *report.Results) error {
+	switch Provider {
+	case "dummy":
+		p := &providers.Dummy{
+			Options: providerOptions,
+			Results: results,
+			Key:     key,
+		}
+		return p.Delete(ctx)
+	case "aws":
+		p := &providers.S3{
+			Options:    providerOptions,
+			S3Client:   s3.New(providers.SetupS3Client(Region, providerOptions)),
+			Results:    results,
+			BucketName: BucketName,
+			Key:        key,
+		}
+		return p.Delete(ctx)
+	case "gcp":
+		p := &providers.GCS{
+			Options:    providerOptions,
+			GCSClient:  providers.SetupGCSClient(),
+			Results:    results,
+			BucketName: BucketName,
+			Key:        key,
+		}
+		return p.Delete(ctx)
+	case "azure":
+		p := &providers.AZBlob{
+			Options:    providerOptions,
+			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
+			Results:    results,
+			BucketName: BucketName,
+			Key:        key,
+		}
+		return p.Delete(ctx)
+	}
+	return fmt.Errorf("Unknown provider %s", Provider)
+}
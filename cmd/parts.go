@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	downloadParts int
+	partsCompare  bool
+)
+
+// addPartsFlags adds the flags that download single objects in parallel ranges.
+func addPartsFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&downloadParts, "parts", 1, "Splits every object into this many ranged GETs that get downloaded in parallel and consumed in order. 1 downloads objects in a single stream.")
+	cmd.Flags().BoolVar(&partsCompare, "parts-compare", false, "Runs the workload with single stream downloads first, to compare their throughput with the parallel ranges run")
+}
+
+// downloader is implemented by all providers
+type downloader interface {
+	Download(ctx context.Context) error
+	DownloadParallel(ctx context.Context, parts int) error
+}
+
+// download reads an object in a single stream or in --parts parallel ranges
+func download(ctx context.Context, p downloader) error {
+	if downloadParts > 1 {
+		return p.DownloadParallel(ctx, downloadParts)
+	}
+	return p.Download(ctx)
+}
+
+// runParts runs objects downloading them in parallel ranges and, with
+// --parts-compare, once more with single stream downloads beforehand, keeping
+// the results as a baseline.
+func runParts(ctx context.Context, objects []providers.ObjectInfo, process func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error) runOutcome {
+	if downloadParts < 1 {
+		color.Red("ERROR: --parts must be at least 1, got [%d].", downloadParts)
+		os.Exit(1)
+	}
+	if partsCompare && downloadParts == 1 {
+		color.Red("ERROR: --parts-compare requires --parts greater than 1.")
+		os.Exit(1)
+	}
+	if hedging() || hedgeCompare {
+		color.Red("ERROR: hedging can't be combined with --parts.")
+		os.Exit(1)
+	}
+
+	parts := downloadParts
+	out := runCompared(ctx, objects, process, "parallel ranges", partsCompare, func() {
+		downloadParts = parts
+	}, func() {
+		downloadParts = 1
+	})
+	// an interrupted comparison only has the single stream run
+	if out.baseline != nil || !partsCompare {
+		out.parts = parts
+	}
+	return out
+}
+
+// partsSummary compares the per-object throughput of parallel range downloads
+// with single stream downloads, if they ran as a baseline.
+func partsSummary(out runOutcome) string {
+	summary := "\nParallel ranges:\n" +
+		"Run|Parts|Objects|Object p50 (MB/s)|Object Mean (MB/s)|Object Min (MB/s)|p50 (ms)|p99 (ms)|Aggregate (MB/s)\n"
+
+	if out.baseline != nil {
+		summary += partsRow("single stream", 1, out.baseline, out.baselineDuration)
+	}
+	summary += partsRow("parallel ranges", out.parts, out.results, out.duration)
+	return summary
+}
+
+func partsRow(name string, parts int, results *report.Results, duration time.Duration) string {
+	var (
+		throughputs []float64
+		bytes       int64
+	)
+	for _, v := range results.Items() {
+		if !v.Success || v.Op != report.OpGet {
+			continue
+		}
+		bytes += int64(v.Size)
+		if v.Duration > 0 {
+			throughputs = append(throughputs, float64(v.Size)/1024/1024/v.Duration.Seconds())
+		}
+	}
+
+	var aggregate float64
+	if duration > 0 {
+		aggregate = float64(bytes) / 1024 / 1024 / duration.Seconds()
+	}
+	p50, mean, min := throughputStats(throughputs)
+	return fmt.Sprintf("%s|%d|%d|%.1f|%.1f|%.1f|%.1f|%.1f|%.1f\n", name, parts, len(throughputs), p50, mean, min,
+		millis(results.Percentile(50)), millis(results.Percentile(99)), aggregate)
+}
+
+// throughputStats returns the median, mean and minimum of values
+func throughputStats(values []float64) (p50, mean, min float64) {
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	return sorted[len(sorted)/2], sum / float64(len(sorted)), sorted[0]
+}
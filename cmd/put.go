@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	numObjects  int
+	objectSize  int
+	ifNoneMatch bool
+	putManifest string
+
+	putCmd = &cobra.Command{
+		Use:   "put",
+		Short: "PUT objects generated in memory to a Bucket",
+		Long:  `Writes --objects objects of --objectsize bytes, generated in memory, as fast as the workers allow. Useful for measuring PUT latency and ops/s of small objects without any local disk IO.`,
+		Run:   initPut,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(putCmd)
+
+	putCmd.Flags().StringVar(&destdir, "destdir", "", "The destination directory on the bucket")
+	putCmd.MarkFlagRequired("destdir")
+
+	putCmd.Flags().IntVar(&numObjects, "objects", 1000, "Amount of objects to write")
+	putCmd.Flags().IntVar(&objectSize, "objectsize", 4096, "Size (in bytes) of each object")
+	putCmd.Flags().BoolVar(&ifNoneMatch, "ifnonematch", false, "Only create objects that don't exist already (If-None-Match: *)")
+	putCmd.Flags().StringVar(&putManifest, "manifest", "", "Writes the key, size and MD5 of every object written to this JSON file, for --keys-from and --verify-manifest")
+
+	putCmd.Flags().IntVar(&numWorkers, "workers", 5, "Amount of parallel put workers")
+
+	addWarmupFlags(putCmd)
+	addRateFlags(putCmd)
+	addRampFlags(putCmd)
+}
+
+func initPut(cmd *cobra.Command, args []string) {
+	// runTasks takes a negative amount as unlimited
+	if numObjects < 0 {
+		color.Red("ERROR: --objects can't be negative, got [%d].", numObjects)
+		os.Exit(1)
+	}
+	if objectSize < 0 {
+		color.Red("ERROR: --objectsize can't be negative, got [%d].", objectSize)
+		os.Exit(1)
+	}
+
+	body := make([]byte, objectSize)
+	rand.Read(body)
+
+	var (
+		writtenMu sync.Mutex
+		written   []string
+	)
+
+	// warm-up tasks get the first sequence numbers, so every task writes a distinct object
+	out := runTasks(cmd.Context(), numObjects, func(ctx context.Context, seq int, results *report.Results) error {
+		key := fmt.Sprintf("%s/object-%08d", destdir, seq)
+		if err := processPut(ctx, key, body, results); err != nil {
+			return err
+		}
+		writtenMu.Lock()
+		written = append(written, key)
+		writtenMu.Unlock()
+		return nil
+	})
+
+	if putManifest != "" {
+		// every object has the same content
+		size, sum := int64(len(body)), md5.Sum(body)
+		sort.Strings(written)
+		entries := make([]manifestEntry, len(written))
+		for i, key := range written {
+			entries[i] = manifestEntry{Key: key, Size: &size, MD5: hex.EncodeToString(sum[:])}
+		}
+		if err := writeManifest(putManifest, entries); err != nil {
+			color.Red("ERROR: Unable to write manifest [%s]: %s", putManifest, err)
+			os.Exit(1)
+		}
+		color.Green(">>> Wrote manifest of [%d] objects to [%s]", len(entries), putManifest)
+	}
+	printResults(out)
+}
+
+func processPut(ctx context.Context, key string, body []byte, results *report.Results) error {
+	switch Provider {
+	case "dummy":
+		p := &providers.Dummy{
+			Options: providerOptions,
+			Results: results,
+			Key:     key,
+			Body:    body,
+		}
+		return p.Put(ctx)
+	case "aws":
+		p := &providers.S3{
+			Options:     providerOptions,
+			S3Client:    s3.New(providers.SetupS3Client(Region, providerOptions)),
+			Results:     results,
+			BucketName:  BucketName,
+			Key:         key,
+			Body:        body,
+			IfNoneMatch: ifNoneMatch,
+		}
+		return p.Put(ctx)
+	case "gcp":
+		p := &providers.GCS{
+			Options:     providerOptions,
+			GCSClient:   providers.SetupGCSClient(),
+			Results:     results,
+			BucketName:  BucketName,
+			Key:         key,
+			Body:        body,
+			IfNoneMatch: ifNoneMatch,
+		}
+		return p.Put(ctx)
+	case "azure":
+		p := &providers.AZBlob{
+			Options:     providerOptions,
+			ServiceURL:  providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
+			Results:     results,
+			BucketName:  BucketName,
+			Key:         key,
+			Body:        body,
+			IfNoneMatch: ifNoneMatch,
+		}
+		return p.Put(ctx)
+	}
+	return fmt.Errorf("Unknown provider %s", Provider)
+}
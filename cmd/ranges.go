@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// Range read modes
+const (
+	rangeRandom     = "random"
+	rangeSequential = "sequential"
+	rangeTrace      = "trace"
+)
+
+var (
+	rangeMode      string
+	rangeSize      int64
+	rangeTraceFile string
+
+	rangesCmd = &cobra.Command{
+		Use:   "ranges",
+		Short: "Read byte ranges of objects of a Bucket",
+		Long:  `Measures the latency of range requests: fixed-size ranges at random offsets, sequential chunks of whole objects, or the ranges of a trace.`,
+		Run:   initRanges,
+	}
+
+	objectSizesMu sync.Mutex
+	objectSizes   = map[string]int64{}
+)
+
+// byteRange is a range of bytes of an object
+type byteRange struct {
+	obj    providers.ObjectInfo
+	offset int64
+	length int64
+}
+
+func init() {
+	rootCmd.AddCommand(rangesCmd)
+
+	addBucketDirFlags(rangesCmd, "The location where files are stored in the bucket. Not needed with --mode trace.")
+	rangesCmd.Flags().IntVar(&maxFiles, "maxfiles", -1, "Limits the amount of files to read ranges of. Applies after filtering, sampling and --order. -1 is unlimited.")
+	rangesCmd.Flags().IntVar(&numWorkers, "workers", 5, "Amount of parallel range read workers")
+	rangesCmd.Flags().Uint64Var(&bufferSize, "buffersize", 8192, "Buffer size (in bytes) that each worker will use")
+
+	rangesCmd.Flags().StringVar(&rangeMode, "mode", rangeRandom, "random (ranges at random offsets), sequential (all chunks of every object, in order) or trace (the ranges of --trace)")
+	rangesCmd.Flags().Int64Var(&rangeSize, "range-size", 64*1024, "Size (in bytes) of every range with --mode random or sequential")
+	rangesCmd.Flags().StringVar(&rangeTraceFile, "trace", "", "CSV file with a key,offset,length line per range to read, for --mode trace")
+
+	addRunLengthFlags(rangesCmd)
+	addWarmupFlags(rangesCmd)
+	addRateFlags(rangesCmd)
+	addRampFlags(rangesCmd)
+}
+
+func initRanges(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+
+	if rangeSize <= 0 {
+		color.Red("ERROR: --range-size must be positive, got [%d].", rangeSize)
+		os.Exit(1)
+	}
+
+	switch rangeMode {
+	case rangeRandom:
+		files := listRangeFiles(ctx)
+		printResults(runKeys(ctx, files, func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error {
+			size, err := sizeOf(ctx, obj)
+			if err != nil {
+				return err
+			}
+			if size == 0 {
+				// an empty object has no range to read
+				return nil
+			}
+
+			length := rangeSize
+			if length > size {
+				length = size
+			}
+			offset := rand.Int63n(size - length + 1)
+			return processRange(ctx, byteRange{obj: obj, offset: offset, length: length}, results)
+		}))
+	case rangeSequential:
+		ranges := chunkRanges(ctx, listRangeFiles(ctx))
+		printResults(runList(ctx, len(ranges), func(ctx context.Context, i int, results *report.Results) error {
+			return processRange(ctx, ranges[i], results)
+		}))
+	case rangeTrace:
+		ranges, err := readTrace(rangeTraceFile)
+		if err != nil {
+			color.Red("ERROR: Unable to read trace [%s]: %s", rangeTraceFile, err)
+			os.Exit(1)
+		}
+		printResults(runList(ctx, len(ranges), func(ctx context.Context, i int, results *report.Results) error {
+			return processRange(ctx, ranges[i], results)
+		}))
+	default:
+		color.Red("ERROR: Unknown mode [%s], expected random, sequential or trace.", rangeMode)
+		os.Exit(1)
+	}
+}
+
+func listRangeFiles(ctx context.Context) []providers.ObjectInfo {
+	if len(bucketDirs) == 0 && keysFrom == "" {
+		color.Red("ERROR: --bucketdir or --keys-from is required with --mode %s.", rangeMode)
+		os.Exit(1)
+	}
+	sanitizeParams()
+
+	files, err := listObjects(ctx)
+	if err != nil {
+		color.Red("ERROR: Unable to list files from bucket: %s, directory: %s. Error: %s.", BucketName, strings.Join(bucketDirs, ","), err)
+		os.Exit(1)
+	}
+
+	// skip the objects listed as empty, which have no range to read
+	nonEmpty := files[:0]
+	for _, obj := range files {
+		if listedSize(obj) != 0 {
+			nonEmpty = append(nonEmpty, obj)
+		}
+	}
+	if skipped := len(files) - len(nonEmpty); skipped > 0 {
+		color.Yellow(">>> Skipping [%d] empty objects", skipped)
+	}
+	files = nonEmpty
+
+	if maxFiles != -1 && len(files) > maxFiles {
+		files = files[:maxFiles]
+	}
+	return files
+}
+
+// chunkRanges splits every file into consecutive ranges of rangeSize bytes
+func chunkRanges(ctx context.Context, files []providers.ObjectInfo) []byteRange {
+	var ranges []byteRange
+	for _, obj := range files {
+		size, err := sizeOf(ctx, obj)
+		if err != nil {
+			color.Red("ERROR: Unable to get the size of [%s]: %s", obj.Key, err)
+			os.Exit(1)
+		}
+
+		for offset := int64(0); offset < size; offset += rangeSize {
+			length := rangeSize
+			if offset+length > size {
+				length = size - offset
+			}
+			ranges = append(ranges, byteRange{obj: obj, offset: offset, length: length})
+		}
+	}
+	return ranges
+}
+
+// readTrace reads the ranges of a CSV file with key,offset,length lines
+func readTrace(path string) ([]byteRange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 3
+
+	var ranges []byteRange
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return ranges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		offset, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset [%s] of [%s]", record[1], record[0])
+		}
+		length, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil || length <= 0 {
+			return nil, fmt.Errorf("invalid length [%s] of [%s]", record[2], record[0])
+		}
+		ranges = append(ranges, byteRange{obj: providers.ObjectInfo{Key: record[0], Size: -1}, offset: offset, length: length})
+	}
+}
+
+// listedSize returns the size of an object as the manifest or the listing
+// has it, -1 when unknown
+func listedSize(obj providers.ObjectInfo) int64 {
+	if e, ok := providerOptions.Objects[obj.Key]; ok && e.Size >= 0 {
+		return e.Size
+	}
+	return obj.Size
+}
+
+// sizeOf returns the size of an object as listed, or looks it up only once
+func sizeOf(ctx context.Context, obj providers.ObjectInfo) (int64, error) {
+	if size := listedSize(obj); size >= 0 {
+		return size, nil
+	}
+
+	objectSizesMu.Lock()
+	size, ok := objectSizes[obj.Key]
+	objectSizesMu.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	size, err := lookupSize(ctx, obj.Key)
+	if err != nil {
+		return 0, err
+	}
+
+	objectSizesMu.Lock()
+	objectSizes[obj.Key] = size
+	objectSizesMu.Unlock()
+	return size, nil
+}
+
+func lookupSize(ctx context.Context, key string) (int64, error) {
+	switch Provider {
+	case "dummy":
+		p := &providers.Dummy{
+			Key: key,
+		}
+		return p.Size(ctx)
+	case "aws":
+		p := &providers.S3{
+			S3Client:   s3.New(providers.SetupS3Client(Region, providerOptions)),
+			BucketName: BucketName,
+			Key:        key,
+		}
+		return p.Size(ctx)
+	case "gcp":
+		p := &providers.GCS{
+			GCSClient:  providers.SetupGCSClient(),
+			BucketName: BucketName,
+			Key:        key,
+		}
+		return p.Size(ctx)
+	case "azure":
+		p := &providers.AZBlob{
+			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
+			BucketName: BucketName,
+			Key:        key,
+		}
+		return p.Size(ctx)
+	}
+	return 0, fmt.Errorf("Unknown provider %s", Provider)
+}
+
+func processRange(ctx context.Context, r byteRange, results *report.Results) error {
+	switch Provider {
+	case "dummy":
+		p := &providers.Dummy{
+			Options:    providerOptions,
+			BufferSize: bufferSize,
+			Results:    results,
+			Key:        r.obj.Key,
+			Object:     r.obj,
+		}
+		return p.DownloadRange(ctx, r.offset, r.length)
+	case "aws":
+		p := &providers.S3{
+			Options:    providerOptions,
+			S3Client:   s3.New(providers.SetupS3Client(Region, providerOptions)),
+			BufferSize: bufferSize,
+			Results:    results,
+			BucketName: BucketName,
+			Key:        r.obj.Key,
+			Object:     r.obj,
+		}
+		return p.DownloadRange(ctx, r.offset, r.length)
+	case "gcp":
+		p := &providers.GCS{
+			Options:    providerOptions,
+			GCSClient:  providers.SetupGCSClient(),
+			BufferSize: bufferSize,
+			Results:    results,
+			BucketName: BucketName,
+			Key:        r.obj.Key,
+			Object:     r.obj,
+		}
+		return p.DownloadRange(ctx, r.offset, r.length)
+	case "azure":
+		p := &providers.AZBlob{
+			Options:    providerOptions,
+			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
+			BufferSize: bufferSize,
+			Results:    results,
+			BucketName: BucketName,
+			Key:        r.obj.Key,
+			Object:     r.obj,
+		}
+		return p.DownloadRange(ctx, r.offset, r.length)
+	}
+	return fmt.Errorf("Unknown provider %s", Provider)
+}
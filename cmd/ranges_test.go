@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dliappis/blobbench/internal/providers"
+)
+
+func TestReadTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []byteRange
+		wantErr bool
+	}{
+		{
+			name:    "ranges",
+			content: "dir/a,0,100\ndir/b,4096,1\n",
+			want: []byteRange{
+				{obj: providers.ObjectInfo{Key: "dir/a", Size: -1}, offset: 0, length: 100},
+				{obj: providers.ObjectInfo{Key: "dir/b", Size: -1}, offset: 4096, length: 1},
+			},
+		},
+		{name: "negative offset", content: "dir/a,-1,100\n", wantErr: true},
+		{name: "zero length", content: "dir/a,0,0\n", wantErr: true},
+		{name: "negative length", content: "dir/a,0,-100\n", wantErr: true},
+		{name: "malformed offset", content: "dir/a,x,100\n", wantErr: true},
+		{name: "missing length", content: "dir/a,0\n", wantErr: true},
+	}
+
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "trace.csv")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readTrace(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readTrace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readTrace() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
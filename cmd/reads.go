@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// readAnalysis returns the reads of every stream recorded with --read-stats,
+// along with the read sizes of all streams.
+func readAnalysis(results *report.Results) string {
+	histogram := make([]int, len(report.ReadSizeBuckets)+1)
+
+	var slices []string
+	for i := 1; i <= report.ThroughputSlices; i++ {
+		slices = append(slices, fmt.Sprintf("T%d (MB/s)", i))
+	}
+	analysis := "\nReads per stream:\n" +
+		"File|Success|Reads|Read Size p50 (KB)|Read Size Max (KB)|First Byte (ms)|Gap p50 (ms)|Gap p99 (ms)|Longest Stall (ms)|" + strings.Join(slices, "|") + "\n"
+
+	for _, m := range results.Items() {
+		r := m.Reads
+		if r == nil {
+			continue
+		}
+		for i, n := range r.SizeHistogram {
+			histogram[i] += n
+		}
+
+		throughput := make([]string, report.ThroughputSlices)
+		for i, t := range r.Throughput {
+			throughput[i] = fmt.Sprintf("%.1f", t)
+		}
+		analysis += fmt.Sprintf("%s|%t|%d|%.1f|%.1f|%.1f|%.1f|%.1f|%.1f|%s\n", m.File, m.Success, r.Reads, float64(r.ReadSizeP50)/1024, float64(r.MaxReadSize)/1024,
+			millis(r.FirstByte), millis(r.GapP50), millis(r.GapP99), millis(r.LongestStall), strings.Join(throughput, "|"))
+	}
+
+	var buckets, counts []string
+	lower := 0
+	for i, n := range histogram {
+		if i < len(report.ReadSizeBuckets) {
+			buckets = append(buckets, fmt.Sprintf("%d-%d KB", lower/1024, report.ReadSizeBuckets[i]/1024))
+			lower = report.ReadSizeBuckets[i]
+		} else {
+			buckets = append(buckets, fmt.Sprintf(">=%d KB", lower/1024))
+		}
+		counts = append(counts, strconv.Itoa(n))
+	}
+	analysis += "\nRead sizes of all streams:\n" + strings.Join(buckets, "|") + "\n" + strings.Join(counts, "|") + "\n"
+
+	return analysis
+}
@@ -1,6 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dliappis/blobbench/internal/providers"
+
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +27,28 @@ var Provider string
 // OutputFile is the filename where results will be written
 var OutputFile string
 
+// providerOptions are passed to every provider, set up from the retry flags
+var providerOptions providers.Options
+
+var (
+	maxAttempts     int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+	retryOn         string
+	sdkRetries      bool
+	debug           bool
+
+	firstByteTimeout time.Duration
+	stallTimeout     time.Duration
+	stallResumes     int
+	readStats        bool
+
+	thinkMode   string
+	thinkTime   time.Duration
+	thinkEvery  int
+	thinkPasses int
+)
+
 var (
 	userLicense string
 
@@ -25,12 +56,31 @@ var (
 		Use:   "blobbench",
 		Short: "benchmarking tool for blob stores",
 		Long:  `TO DO`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			setupProviderOptions()
+		},
 	}
 )
 
 // Execute executes the root command.
+// The first SIGINT or SIGTERM cancels the context of the command, so that it
+// stops issuing requests, aborts in-flight ones and reports what it collected
+// so far. A second one exits immediately.
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		color.Yellow("\n>>> Interrupted, stopping. Send another signal to exit immediately.")
+		cancel()
+		<-signals
+		os.Exit(1)
+	}()
+
+	return rootCmd.ExecuteContext(ctx)
 }
 
 func init() {
@@ -40,4 +90,87 @@ func init() {
 	rootCmd.MarkFlagRequired("provider")
 	rootCmd.PersistentFlags().StringVar(&Provider, "provider", "", "Specifies the provider (aws, gcp, azure, dummy)")
 	rootCmd.PersistentFlags().StringVar(&OutputFile, "output", "", "Stores results to the specified file")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Prints every operation as it starts, which slows down workloads of small operations")
+	rootCmd.PersistentFlags().DurationVar(&requestTimeout, "request-timeout", 0, "Aborts every attempt of an operation that takes longer than this, e.g. 30s; --retry-on timeout retries it. 0 means no timeout.")
+	rootCmd.PersistentFlags().IntVar(&maxAttempts, "max-attempts", 1, "Maximum attempts per operation, retried by blobbench itself. 1 disables retries.")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", 100*time.Millisecond, "Base delay before a retry, doubled on every attempt with full jitter")
+	rootCmd.PersistentFlags().DurationVar(&retryMaxBackoff, "retry-max-backoff", 5*time.Second, "Maximum delay before a retry")
+	rootCmd.PersistentFlags().StringVar(&retryOn, "retry-on", "throttled,server_error,timeout,connection", "Comma separated error classes to retry on (throttled, server_error, timeout, connection, integrity)")
+	rootCmd.PersistentFlags().BoolVar(&sdkRetries, "sdk-retries", true, "Keep the retries built into the SDKs. Set to false for raw measurements; not supported by gcp.")
+	rootCmd.PersistentFlags().DurationVar(&firstByteTimeout, "first-byte-timeout", 0, "Aborts downloads that didn't receive their first byte after this long, e.g. 5s. 0 means no timeout.")
+	rootCmd.PersistentFlags().DurationVar(&stallTimeout, "stall-timeout", 0, "Aborts downloads that receive no bytes for this long between two reads, e.g. 10s. 0 means no timeout.")
+	rootCmd.PersistentFlags().Float64Var(&bandwidthLimit, "bandwidth-limit", 0, "Limits the bandwidth of all transfers together, in MB/s. 0 means no limit.")
+	rootCmd.PersistentFlags().Float64Var(&workerBandwidthLimit, "worker-bandwidth-limit", 0, "Limits the bandwidth of the transfers of each worker, in MB/s. 0 means no limit.")
+	rootCmd.PersistentFlags().StringVar(&thinkMode, "think", "", "Processes downloaded data like a slow consumer: fixed or random pauses, or CPU-bound sha256 or compress work")
+	rootCmd.PersistentFlags().DurationVar(&thinkTime, "think-time", 10*time.Millisecond, "Pause of --think fixed, longest pause of --think random")
+	rootCmd.PersistentFlags().IntVar(&thinkEvery, "think-every", 0, "Bytes to read before every pause of --think fixed or random. 0 pauses after every read.")
+	rootCmd.PersistentFlags().IntVar(&thinkPasses, "think-passes", 1, "How many times --think sha256 or compress processes the data")
+	rootCmd.PersistentFlags().BoolVar(&readStats, "read-stats", false, "Records every read of downloaded streams and reports read sizes, gaps between reads, stalls and throughput over the life of each stream")
+	rootCmd.PersistentFlags().BoolVar(&verify, "verify", false, "Checks that downloads deliver as many bytes as announced and, for whole objects, that their content matches the checksum of the provider: the MD5 in the ETag of S3 objects not uploaded in parts, Content-MD5 on Azure. GCS checks CRC32C on its own.")
+	rootCmd.PersistentFlags().StringVar(&verifyManifest, "verify-manifest", "", "File with the sizes and MD5s downloads get verified against, in any format of --keys-from, taking precedence over the listing and what the provider reports. Implies --verify.")
+	rootCmd.PersistentFlags().IntVar(&stallResumes, "stall-resumes", 0, "Resumes downloads aborted by --first-byte-timeout or --stall-timeout up to this many times, from the last byte read")
+}
+
+func setupProviderOptions() {
+	if maxAttempts < 1 {
+		color.Red("ERROR: --max-attempts must be at least 1, got [%d].", maxAttempts)
+		os.Exit(1)
+	}
+
+	classes, err := providers.ParseRetryOn(retryOn)
+	if err != nil {
+		color.Red("ERROR: %s", err)
+		os.Exit(1)
+	}
+
+	if !sdkRetries && Provider == "gcp" {
+		color.Yellow("WARNING: The GCS client retries internally and this can't be disabled, ignoring --sdk-retries=false.")
+	}
+
+	providerOptions = providers.Options{
+		Retry: providers.RetryPolicy{
+			MaxAttempts: maxAttempts,
+			Backoff:     retryBackoff,
+			MaxBackoff:  retryMaxBackoff,
+			RetryOn:     classes,
+		},
+		RequestTimeout:   requestTimeout,
+		Debug:            debug,
+		SDKRetries:       sdkRetries,
+		FirstByteTimeout: firstByteTimeout,
+		StallTimeout:     stallTimeout,
+		StallResumes:     stallResumes,
+		ReadStats:        readStats,
+		Recursive:        recursive,
+		Objects:          map[string]providers.Expected{},
+	}
+	if verifyManifest != "" {
+		manifest, err := readManifest(verifyManifest)
+		if err != nil {
+			color.Red("ERROR: Unable to read manifest [%s]: %s", verifyManifest, err)
+			os.Exit(1)
+		}
+		verify = true
+		providerOptions.Objects = manifest
+	}
+	providerOptions.Verify = verify
+	if thinkMode != "" {
+		consumer, err := providers.NewConsumer(thinkMode, thinkEvery, thinkTime, thinkPasses)
+		if err != nil {
+			color.Red("ERROR: %s", err)
+			os.Exit(1)
+		}
+		providerOptions.Consumer = consumer
+	}
+	if bandwidthLimit < 0 {
+		color.Red("ERROR: --bandwidth-limit can't be negative, got [%f].", bandwidthLimit)
+		os.Exit(1)
+	}
+	if workerBandwidthLimit < 0 {
+		color.Red("ERROR: --worker-bandwidth-limit can't be negative, got [%f].", workerBandwidthLimit)
+		os.Exit(1)
+	}
+	if bandwidthLimit > 0 {
+		providerOptions.Bandwidth = providers.NewLimiter(bandwidthLimit * 1024 * 1024)
+	}
 }
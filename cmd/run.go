@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/pool"
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	runDuration time.Duration
+	totalOps    int
+	sampling    string
+
+	requestTimeout time.Duration
+
+	warmupDuration time.Duration
+	warmupOps      int
+	reportWarmup   bool
+
+	rate    float64
+	arrival string
+
+	rampStep     int
+	rampInterval time.Duration
+	rampMax      int
+	rampMode     string
+)
+
+// rampChange records when the pool got resized by a ramp-up schedule
+type rampChange struct {
+	at      time.Time
+	workers int
+}
+
+// runOutcome holds everything collected during a run that ends up in the report
+type runOutcome struct {
+	results  *report.Results
+	duration time.Duration
+	// warmup is only set when warm-up stats should be reported
+	warmup         *report.Results
+	warmupDuration time.Duration
+	// ramp is only set when a ramp-up schedule was used
+	ramp      []rampChange
+	startTime time.Time
+	// interrupted is set when the run was cancelled before its end
+	interrupted bool
+	workers     []pool.WorkerStats
+	// hedged is set when GET requests got hedged, parts when objects got
+	// downloaded in parallel ranges. baseline holds the results of the same
+	// workload without either when it ran for comparison.
+	hedged           bool
+	parts            int
+	baseline         *report.Results
+	baselineDuration time.Duration
+}
+
+// addRunLengthFlags adds the flags that let a command keep working on the listed
+// objects until a deadline or a total amount of operations is reached.
+func addRunLengthFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&runDuration, "duration", 0, "Keeps the workers busy until this much time has passed, e.g. 30m. 0 means a single pass over the files.")
+	cmd.Flags().IntVar(&totalOps, "total-ops", 0, "Keeps the workers busy until this many operations have been issued. 0 means a single pass over the files.")
+	cmd.Flags().StringVar(&sampling, "sampling", "cycle", "How files are picked with --duration or --total-ops: cycle (in listing order) or random")
+}
+
+// addWarmupFlags adds the flags that control the warm-up phase of a run.
+func addWarmupFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&warmupDuration, "warmup", 0, "Runs the workload for this long, e.g. 30s, before recording results")
+	cmd.Flags().IntVar(&warmupOps, "warmup-ops", 0, "Runs this many operations before recording results")
+	cmd.Flags().BoolVar(&reportWarmup, "report-warmup", false, "Reports the stats of the warm-up phase separately")
+}
+
+// addRateFlags adds the flags that switch a command to open-loop load generation.
+func addRateFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&rate, "rate", 0, "Issues operations at this rate (ops/s) regardless of their completion (open-loop); --workers caps the in-flight operations. 0 keeps the workers busy back-to-back (closed-loop).")
+	cmd.Flags().StringVar(&arrival, "arrival", pool.ArrivalConstant, "Arrival process of open-loop operations: constant or poisson")
+}
+
+// addRampFlags adds the flags that grow the pool during a run.
+func addRampFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&rampStep, "ramp-step", 0, "Workers to add every --ramp-interval, e.g. 10. 0 disables the ramp-up.")
+	cmd.Flags().DurationVar(&rampInterval, "ramp-interval", 30*time.Second, "Interval between ramp-up steps")
+	cmd.Flags().IntVar(&rampMax, "ramp-max", 0, "Amount of workers at which the ramp-up stops")
+	cmd.Flags().StringVar(&rampMode, "ramp-mode", "step", "How workers are added: step (all --ramp-step workers at once) or linear (one at a time, evenly spread over --ramp-interval)")
+}
+
+// startRamp grows p according to the ramp-up schedule until it reaches
+// rampMax or stop gets closed. The returned channel delivers the changes
+// made to the pool once the ramp-up is over.
+func startRamp(p *pool.Pool, stop <-chan struct{}) <-chan []rampChange {
+	changes := make(chan []rampChange, 1)
+	ramp := []rampChange{{at: time.Now(), workers: p.Size()}}
+
+	tick, add := rampInterval, rampStep
+	if rampMode == "linear" {
+		tick, add = rampInterval/time.Duration(rampStep), 1
+	}
+
+	go func() {
+		defer func() { changes <- ramp }()
+
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				n := rampMax - p.Size()
+				if n <= 0 {
+					return
+				}
+				if n > add {
+					n = add
+				}
+				p.AddWorkers(n)
+				ramp = append(ramp, rampChange{at: time.Now(), workers: p.Size()})
+				color.Yellow(">>> Ramp-up: [%d] workers", p.Size())
+			}
+		}
+	}()
+	return changes
+}
+
+// runKeys runs process for every object, honoring maxFiles, using a pool of
+// numWorkers workers and returns the collected results.
+// With runDuration or totalOps set, objects are cycled through or randomly
+// sampled (see sampling) until the deadline or the amount of operations is reached.
+func runKeys(ctx context.Context, objects []providers.ObjectInfo, process func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error) runOutcome {
+	if maxFiles != -1 && len(objects) > maxFiles {
+		objects = objects[:maxFiles]
+	}
+
+	return runList(ctx, len(objects), func(ctx context.Context, i int, results *report.Results) error {
+		return process(ctx, objects[i], results)
+	})
+}
+
+// runList runs process for every item of a list of numItems items, like
+// runKeys does for objects, passing the index of the item.
+func runList(ctx context.Context, numItems int, process func(ctx context.Context, i int, results *report.Results) error) runOutcome {
+	numTasks := numItems
+	if runDuration > 0 || totalOps > 0 {
+		numTasks = -1
+		if totalOps > 0 {
+			numTasks = totalOps
+		}
+	} else if sampling == "random" {
+		color.Red("ERROR: Random sampling requires --duration or --total-ops.")
+		os.Exit(1)
+	}
+
+	if numItems == 0 {
+		color.Red("ERROR: No files found to work on.")
+		os.Exit(1)
+	}
+
+	// cycling also covers every item exactly once in a single pass, even when
+	// warm-up tasks took the first items
+	pick := picker(numItems)
+
+	return runTasks(ctx, numTasks, func(ctx context.Context, seq int, results *report.Results) error {
+		return process(ctx, pick(seq), results)
+	})
+}
+
+// picker returns a function picking the index of the item the task with the
+// sequence number seq works on, out of numItems items, according to sampling.
+func picker(numItems int) func(seq int) int {
+	switch sampling {
+	case "cycle":
+		return func(seq int) int { return seq % numItems }
+	case "random":
+		return func(seq int) int { return rand.Intn(numItems) }
+	}
+	color.Red("ERROR: Unknown sampling [%s], expected cycle or random.", sampling)
+	os.Exit(1)
+	return nil
+}
+
+// runCompared runs objects with a feature that enable turns on and, when compare
+// is set, once more beforehand without it, keeping those results as a baseline.
+func runCompared(ctx context.Context, objects []providers.ObjectInfo, process func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error, feature string, compare bool, enable func(), disable func()) runOutcome {
+	var baseline *runOutcome
+	if compare {
+		color.Yellow(">>> Running without %s first", feature)
+		b := runKeys(ctx, objects, process)
+		if b.interrupted {
+			return b
+		}
+		baseline = &b
+		color.Yellow(">>> Running with %s", feature)
+	}
+
+	enable()
+	out := runKeys(ctx, objects, process)
+	disable()
+
+	if baseline != nil {
+		out.baseline, out.baselineDuration = baseline.results, baseline.duration
+	}
+	return out
+}
+
+// runTasks runs process numTasks times (-1 is unlimited), passing the sequence
+// number of each task, using a pool of numWorkers workers and returns the
+// collected results. No new tasks are issued once runDuration, if set, has passed.
+//
+// With rate set, tasks are issued at their intended start time computed by a
+// pool.Pacer and the latency of their operations is measured from it, so that
+// delays caused by a saturated pool aren't omitted (coordinated omission).
+//
+// Tasks issued during the warm-up phase (see warmupDuration and warmupOps) come
+// first and don't count towards numTasks and runDuration; their records are
+// kept apart from the results.
+func runTasks(ctx context.Context, numTasks int, process func(ctx context.Context, seq int, results *report.Results) error) runOutcome {
+	startTime := time.Now()
+	color.Green(">>> Threadpool started")
+
+	var pacer *pool.Pacer
+	if rate < 0 {
+		color.Red("ERROR: --rate can't be negative, got [%f].", rate)
+		os.Exit(1)
+	}
+	if rate > 0 {
+		var err error
+		if pacer, err = pool.NewPacer(rate, arrival); err != nil {
+			color.Red("ERROR: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	workerPool, _ := pool.NewPool(pool.Config{NumWorkers: numWorkers})
+	results := &report.Results{}
+	warmupResults := &report.Results{}
+
+	var rampChanges <-chan []rampChange
+	stopRamp := make(chan struct{})
+	if rampStep < 0 {
+		color.Red("ERROR: --ramp-step can't be negative, got [%d].", rampStep)
+		os.Exit(1)
+	}
+	if rampStep > 0 {
+		if rampMode != "step" && rampMode != "linear" {
+			color.Red("ERROR: Unknown ramp mode [%s], expected step or linear.", rampMode)
+			os.Exit(1)
+		}
+		if rampInterval <= 0 {
+			color.Red("ERROR: --ramp-interval must be positive, got [%s].", rampInterval)
+			os.Exit(1)
+		}
+		if rampMode == "linear" && rampInterval/time.Duration(rampStep) <= 0 {
+			color.Red("ERROR: --ramp-interval [%s] is too short to add [%d] workers one at a time.", rampInterval, rampStep)
+			os.Exit(1)
+		}
+		rampChanges = startRamp(workerPool, stopRamp)
+	}
+
+	var measureStart time.Time
+	measured := 0
+
+	// warm-up tasks may still be running once measured tasks are issued, so the
+	// warm-up phase is considered over once its last task has finished
+	var warmupMu sync.Mutex
+	var warmupEnd time.Time
+	for idx := 0; ctx.Err() == nil; idx++ {
+		target := warmupResults
+		if idx >= warmupOps && time.Since(startTime) >= warmupDuration {
+			if measureStart.IsZero() {
+				measureStart = time.Now()
+				color.Green(">>> Warm-up finished after [%d] tasks", idx)
+			}
+			if numTasks >= 0 && measured >= numTasks {
+				break
+			}
+			if runDuration > 0 && time.Since(measureStart) >= runDuration {
+				break
+			}
+			measured++
+			target = results
+		}
+
+		var intended time.Time
+		if pacer != nil {
+			var err error
+			if intended, err = pacer.Next(ctx); err != nil {
+				break
+			}
+		}
+
+		seq := idx
+
+		task := func(w *pool.WorkerContext) error {
+			if ctx.Err() != nil {
+				// interrupted while queued, don't even start
+				return nil
+			}
+			taskCtx, cancel := requestContext(ctx, w)
+			defer cancel()
+
+			// ----- TaskFunc definition -------------------------------
+			err := processTask(w, intended, func(results *report.Results) error { return process(taskCtx, seq, results) }, target)
+			// ---------------------------------------------------------
+
+			if target == warmupResults {
+				warmupMu.Lock()
+				warmupEnd = time.Now()
+				warmupMu.Unlock()
+			}
+			return err
+		}
+
+		if err := workerPool.Add(ctx, task); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			color.Red("ERROR: Adding item: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	// the ramp-up must be over before waiting, or it could still add workers
+	close(stopRamp)
+	var ramp []rampChange
+	if rampChanges != nil {
+		ramp = <-rampChanges
+	}
+	if err := workerPool.Wait(); err != nil {
+		color.Red("ERROR: Closing: %s", err)
+	}
+
+	color.Green(">>> Threadpool exited\n\n")
+
+	if pacer != nil && measured > 0 {
+		color.Yellow(">>> Open-loop: target rate [%.1f ops/s], achieved [%.1f ops/s]", rate, float64(measured)/time.Since(measureStart).Seconds())
+	}
+
+	if measureStart.IsZero() {
+		// interrupted during the warm-up
+		measureStart = time.Now()
+	}
+
+	out := runOutcome{
+		results:     results,
+		duration:    time.Since(measureStart),
+		startTime:   startTime,
+		interrupted: ctx.Err() != nil,
+		workers:     workerPool.Stats(),
+		ramp:        ramp,
+	}
+	if reportWarmup && len(warmupResults.Items()) > 0 {
+		out.warmup = warmupResults
+		out.warmupDuration = warmupEnd.Sub(startTime)
+	}
+	return out
+}
+
+// requestContext returns the context of a single task run by worker w, derived
+// from ctx. requestTimeout applies to every attempt of its operations instead.
+func requestContext(ctx context.Context, w *pool.WorkerContext) (context.Context, context.CancelFunc) {
+	return context.WithCancel(withWorkerLimiter(ctx, w))
+}
+
+// processTask runs process on worker w and pushes its records into results,
+// tagged with the worker and the time the task waited in the queue.
+// For open-loop tasks, i.e. when intended is set, durations are measured from
+// the intended instead of the actual start time.
+func processTask(w *pool.WorkerContext, intended time.Time, process func(results *report.Results) error, results *report.Results) error {
+	var lag time.Duration
+	if !intended.IsZero() {
+		lag = time.Since(intended)
+	}
+	local := &report.Results{}
+
+	err := process(local)
+
+	for _, m := range local.Items() {
+		m.Worker = w.ID
+		m.QueueWait = w.QueueWait
+		m.ScheduleLag = lag
+		if m.Success {
+			m.Duration += lag
+		}
+		w.Bytes += int64(m.Size)
+		results.Push(m)
+	}
+	return err
+}
+
+// workerSummary returns the statistics of every worker of a run, to spot
+// stragglers and head-of-line blocking.
+func workerSummary(out runOutcome) string {
+	summary := "\nWorkers:\n" +
+		"Worker|Tasks|Errors|MB Moved|Busy (s)|Idle (s)|Utilization (%)|Queue Wait p50 (ms)|Queue Wait Max (ms)\n"
+
+	for _, w := range out.workers {
+		var waits []time.Duration
+		for _, m := range out.results.Items() {
+			if m.Worker == w.ID {
+				waits = append(waits, m.QueueWait)
+			}
+		}
+		sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+
+		var p50, max time.Duration
+		if len(waits) > 0 {
+			p50, max = waits[(len(waits)-1)/2], waits[len(waits)-1]
+		}
+
+		var utilization float64
+		if total := w.Busy + w.Idle; total > 0 {
+			utilization = float64(w.Busy) * 100 / float64(total)
+		}
+		summary += fmt.Sprintf("%d|%d|%d|%.1f|%.1f|%.1f|%.1f|%.1f|%.1f\n", w.ID, w.Tasks, w.Errors, float64(w.Bytes)/(1024*1024), w.Busy.Seconds(), w.Idle.Seconds(), utilization, millis(p50), millis(max))
+	}
+	return summary
+}
+
+// rampTimeline returns the results of a ramped-up run per --ramp-interval,
+// along with the amount of workers at the start of each interval.
+func rampTimeline(out runOutcome) string {
+	timeline := "\nRamp-up timeline:\n" +
+		"Start (s)|Workers|Ops|Errors|Ops/s|Throughput (MB/s)|p50 (ms)|p99 (ms)\n"
+
+	end := time.Now()
+	change := 0
+	for from := out.startTime; from.Before(end); from = from.Add(rampInterval) {
+		to := from.Add(rampInterval)
+		// a tick changes the pool just after its interval starts, so the
+		// interval is labeled with the workers it ended with
+		for change+1 < len(out.ramp) && out.ramp[change+1].at.Before(to) {
+			change++
+		}
+
+		window := out.results.Filter(func(m report.MetricRecord) bool {
+			return !m.Start.Before(from) && m.Start.Before(to)
+		})
+		summary := window.Summarize(rampInterval)
+		timeline += fmt.Sprintf("%.1f|%d|%d|%d|%.1f|%.1f|%.1f|%.1f\n", from.Sub(out.startTime).Seconds(), out.ramp[change].workers, summary.Ops, summary.Failures, summary.OpsPerSec(), summary.ThroughputMBps(), millis(window.Percentile(50)), millis(window.Percentile(99)))
+	}
+	return timeline
+}
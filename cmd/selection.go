@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"math/rand"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+)
+
+// Orders of the selected objects
+const (
+	orderListing       = "listing"
+	orderLexicographic = "lexicographic"
+	orderShuffle       = "shuffle"
+	orderSizeAsc       = "size-asc"
+	orderSizeDesc      = "size-desc"
+)
+
+var (
+	includePatterns []string
+	excludePatterns []string
+	minSize         int64
+	maxSize         int64
+	sampleFraction  float64
+	selectSeed      int64
+	selectOrder     string
+)
+
+// addSelectionFlags adds the flags filtering, sampling and ordering the listed objects
+func addSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&includePatterns, "include", nil, "Only selects objects whose key matches one of these globs, or regular expressions when prefixed with re:")
+	cmd.Flags().StringSliceVar(&excludePatterns, "exclude", nil, "Leaves out objects whose key matches one of these globs, or regular expressions when prefixed with re:")
+	cmd.Flags().Int64Var(&minSize, "min-size", 0, "Only selects objects of at least this many bytes")
+	cmd.Flags().Int64Var(&maxSize, "max-size", -1, "Only selects objects of at most this many bytes. -1 is unlimited.")
+	cmd.Flags().Float64Var(&sampleFraction, "sample-fraction", 1, "Selects a random fraction of the objects, e.g. 0.1 for 10%")
+	cmd.Flags().Int64Var(&selectSeed, "seed", 0, "Seed of --sample-fraction and --order shuffle, to select the same objects in every run. 0 picks a new seed every time.")
+	cmd.Flags().StringVar(&selectOrder, "order", orderListing, "Order of the selected objects: listing, lexicographic, shuffle, size-asc or size-desc")
+}
+
+// selecting reports whether objects need to be selected out of a full listing
+func selecting() bool {
+	return len(includePatterns) > 0 || len(excludePatterns) > 0 || minSize > 0 || maxSize >= 0 || sampleFraction < 1 || selectOrder != orderListing
+}
+
+// selectObjects filters, samples and orders objects according to the
+// selection flags, and keeps the first maxFiles of them.
+func selectObjects(objects []providers.ObjectInfo) []providers.ObjectInfo {
+	if sampleFraction <= 0 || sampleFraction > 1 {
+		color.Red("ERROR: --sample-fraction must be greater than 0 and at most 1, got [%f].", sampleFraction)
+		os.Exit(1)
+	}
+	include, exclude := compilePatterns("include", includePatterns), compilePatterns("exclude", excludePatterns)
+
+	if selectSeed == 0 {
+		selectSeed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(selectSeed))
+
+	var selected []providers.ObjectInfo
+	for _, obj := range objects {
+		switch {
+		case len(include) > 0 && !matchesAny(include, obj.Key), matchesAny(exclude, obj.Key):
+			continue
+		case obj.Size < minSize, maxSize >= 0 && obj.Size > maxSize:
+			continue
+		case sampleFraction < 1 && rnd.Float64() >= sampleFraction:
+			continue
+		}
+		selected = append(selected, obj)
+	}
+
+	switch selectOrder {
+	case orderListing:
+	case orderLexicographic:
+		sort.SliceStable(selected, func(i, j int) bool { return selected[i].Key < selected[j].Key })
+	case orderShuffle:
+		rnd.Shuffle(len(selected), func(i, j int) { selected[i], selected[j] = selected[j], selected[i] })
+	case orderSizeAsc:
+		sort.SliceStable(selected, func(i, j int) bool { return selected[i].Size < selected[j].Size })
+	case orderSizeDesc:
+		sort.SliceStable(selected, func(i, j int) bool { return selected[i].Size > selected[j].Size })
+	default:
+		color.Red("ERROR: Unknown order [%s], expected listing, lexicographic, shuffle, size-asc or size-desc.", selectOrder)
+		os.Exit(1)
+	}
+
+	if maxFiles != -1 && len(selected) > maxFiles {
+		selected = selected[:maxFiles]
+	}
+
+	color.Yellow(">>> Selected [%d] out of [%d] listed objects, seed [%d]", len(selected), len(objects), selectSeed)
+	return selected
+}
+
+// compilePatterns turns globs, or regular expressions prefixed with re:, into
+// functions matching keys
+func compilePatterns(flag string, patterns []string) []func(key string) bool {
+	var matchers []func(key string) bool
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "re:") {
+			re, err := regexp.Compile(strings.TrimPrefix(p, "re:"))
+			if err != nil {
+				color.Red("ERROR: Invalid --%s regular expression [%s]: %s", flag, p, err)
+				os.Exit(1)
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+
+		glob := p
+		if _, err := path.Match(glob, ""); err != nil {
+			color.Red("ERROR: Invalid --%s glob [%s]: %s", flag, p, err)
+			os.Exit(1)
+		}
+		matchers = append(matchers, func(key string) bool {
+			ok, _ := path.Match(glob, key)
+			return ok
+		})
+	}
+	return matchers
+}
+
+func matchesAny(matchers []func(key string) bool, key string) bool {
+	for _, match := range matchers {
+		if match(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dliappis/blobbench/internal/providers"
+)
+
+func TestSelectObjects(t *testing.T) {
+	objects := []providers.ObjectInfo{
+		{Key: "data/b.json", Size: 300},
+		{Key: "data/a.csv", Size: 100},
+		{Key: "data/c.json", Size: 200},
+		{Key: "logs/d.log", Size: 50},
+	}
+
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		minSize  int64
+		maxSize  int64
+		order    string
+		maxFiles int
+		want     []string
+	}{
+		{name: "everything", want: []string{"data/b.json", "data/a.csv", "data/c.json", "logs/d.log"}},
+		{name: "include glob", include: []string{"data/*.json"}, want: []string{"data/b.json", "data/c.json"}},
+		{name: "include regexp", include: []string{"re:\\.(csv|log)$"}, want: []string{"data/a.csv", "logs/d.log"}},
+		{name: "exclude", exclude: []string{"logs/*"}, want: []string{"data/b.json", "data/a.csv", "data/c.json"}},
+		{name: "sizes", minSize: 100, maxSize: 200, want: []string{"data/a.csv", "data/c.json"}},
+		{name: "lexicographic", order: orderLexicographic, want: []string{"data/a.csv", "data/b.json", "data/c.json", "logs/d.log"}},
+		{name: "size-asc", order: orderSizeAsc, want: []string{"logs/d.log", "data/a.csv", "data/c.json", "data/b.json"}},
+		{name: "size-desc after maxfiles", order: orderSizeDesc, maxFiles: 2, want: []string{"data/b.json", "data/c.json"}},
+	}
+
+	defer func() {
+		includePatterns, excludePatterns, minSize, maxSize = nil, nil, 0, -1
+		sampleFraction, selectSeed, selectOrder, maxFiles = 1, 0, orderListing, -1
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			includePatterns, excludePatterns, minSize, maxSize = tt.include, tt.exclude, tt.minSize, tt.maxSize
+			if tt.maxSize == 0 {
+				maxSize = -1
+			}
+			selectOrder = tt.order
+			if selectOrder == "" {
+				selectOrder = orderListing
+			}
+			maxFiles = tt.maxFiles
+			if maxFiles == 0 {
+				maxFiles = -1
+			}
+			sampleFraction = 1
+
+			var got []string
+			for _, obj := range selectObjects(objects) {
+				got = append(got, obj.Key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectObjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectObjectsSeed(t *testing.T) {
+	var objects []providers.ObjectInfo
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		objects = append(objects, providers.ObjectInfo{Key: key})
+	}
+
+	defer func() {
+		sampleFraction, selectSeed, selectOrder, maxFiles = 1, 0, orderListing, -1
+	}()
+	includePatterns, excludePatterns, minSize, maxSize, maxFiles = nil, nil, 0, -1, -1
+	sampleFraction, selectOrder = 0.5, orderShuffle
+
+	selectSeed = 42
+	first := selectObjects(objects)
+	selectSeed = 42
+	second := selectObjects(objects)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed selected %v, then %v", first, second)
+	}
+}
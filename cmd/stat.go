@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	statCmd = &cobra.Command{
+		Use:   "stat",
+		Short: "Issue metadata-only requests (HEAD) against objects of a Bucket",
+		Long:  `Measures the latency of metadata-only calls (S3 HeadObject, GCS object attributes, Azure GetProperties) separately from data transfer.`,
+		Run:   initStat,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(statCmd)
+
+	addBucketDirFlags(statCmd, "The location where files are stored in the bucket.")
+	statCmd.Flags().IntVar(&maxFiles, "maxfiles", -1, "Limits the amount of files to stat. Applies after filtering, sampling and --order. -1 is unlimited.")
+
+	statCmd.Flags().IntVar(&numWorkers, "workers", 5, "Amount of parallel stat workers")
+
+	addRunLengthFlags(statCmd)
+	addWarmupFlags(statCmd)
+	addRateFlags(statCmd)
+	addRampFlags(statCmd)
+}
+
+func initStat(cmd *cobra.Command, args []string) {
+	sanitizeParams()
+
+	files, err := listObjects(cmd.Context())
+	if err != nil {
+		color.Red("ERROR: Unable to list files from bucket: %s, directory: %s. Error: %s.", BucketName, strings.Join(bucketDirs, ","), err)
+		os.Exit(1)
+	}
+
+	printResults(runKeys(cmd.Context(), files, processStat))
+}
+
+func processStat(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error {
+	switch Provider {
+	case "dummy":
+		p := &providers.Dummy{
+			Options: providerOptions,
+			Results: results,
+			Key:     obj.Key,
+		}
+		return p.Stat(ctx)
+	case "aws":
+		p := &providers.S3{
+			Options:    providerOptions,
+			S3Client:   s3.New(providers.SetupS3Client(Region, providerOptions)),
+			Results:    results,
+			BucketName: BucketName,
+			Key:        obj.Key,
+		}
+		return p.Stat(ctx)
+	case "gcp":
+		p := &providers.GCS{
+			Options:    providerOptions,
+			GCSClient:  providers.SetupGCSClient(),
+			Results:    results,
+			BucketName: BucketName,
+			Key:        obj.Key,
+		}
+		return p.Stat(ctx)
+	case "azure":
+		p := &providers.AZBlob{
+			Options:    providerOptions,
+			ServiceURL: providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
+			Results:    results,
+			BucketName: BucketName,
+			Key:        obj.Key,
+		}
+		return p.Stat(ctx)
+	}
+	return fmt.Errorf("Unknown provider %s", Provider)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	sweepOp         string
+	workerSteps     string
+	bufferSizeSteps string
+	stepDuration    time.Duration
+
+	sweepCmd = &cobra.Command{
+		Use:   "sweep",
+		Short: "Run the same workload at increasing concurrency to produce a scaling curve",
+		Long: `Runs --op against the objects under --bucketdir for --step-duration at every worker count of --workers
+(and every buffer size of --buffersizes) and reports throughput and latency percentiles versus concurrency,
+to spot the point where the store or the network saturates.`,
+		Run: initSweep,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(sweepCmd)
+
+	addBucketDirFlags(sweepCmd, "The location where files are stored in the bucket.")
+	sweepCmd.Flags().IntVar(&maxFiles, "maxfiles", -1, "Limits the amount of files to work on. Applies after filtering, sampling and --order. -1 is unlimited.")
+
+	sweepCmd.Flags().StringVar(&sweepOp, "op", "get", "Operation to run at every step: get or head")
+	sweepCmd.Flags().StringVar(&workerSteps, "workers", "1..64x2", "Worker counts to step through, either a list (1,4,16) or a geometric series (start..maxxfactor, e.g. 1..64x2)")
+	sweepCmd.Flags().StringVar(&bufferSizeSteps, "buffersizes", "8192", "Buffer sizes (in bytes) to step through, either a list or a geometric series")
+	sweepCmd.Flags().DurationVar(&stepDuration, "step-duration", time.Minute, "How long to run every step for")
+	sweepCmd.Flags().StringVar(&sampling, "sampling", "cycle", "How files are picked: cycle (in listing order) or random")
+
+	addWarmupFlags(sweepCmd)
+}
+
+// parseSteps parses either a comma separated list of positive integers or a
+// geometric series written as start..maxxfactor, e.g. 1..64x2.
+func parseSteps(spec string) ([]int, error) {
+	if strings.Contains(spec, "..") {
+		var start, max, factor int
+		if _, err := fmt.Sscanf(spec, "%d..%dx%d", &start, &max, &factor); err != nil {
+			return nil, fmt.Errorf("Invalid series [%s], expected start..maxxfactor: %s", spec, err)
+		}
+		if start < 1 || factor < 2 || max < start {
+			return nil, fmt.Errorf("Invalid series [%s], expected 1 <= start <= max and factor >= 2", spec)
+		}
+
+		var steps []int
+		for v := start; v <= max; v *= factor {
+			steps = append(steps, v)
+		}
+		return steps, nil
+	}
+
+	var steps []int
+	for _, s := range strings.Split(spec, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("Invalid step [%s] in [%s], expected a positive integer", s, spec)
+		}
+		steps = append(steps, v)
+	}
+	return steps, nil
+}
+
+func initSweep(cmd *cobra.Command, args []string) {
+	sanitizeParams()
+
+	var process func(ctx context.Context, obj providers.ObjectInfo, results *report.Results) error
+	switch sweepOp {
+	case "get":
+		process = processDownload
+	case "head":
+		process = processStat
+	default:
+		color.Red("ERROR: Unknown operation [%s], expected get or head.", sweepOp)
+		os.Exit(1)
+	}
+
+	workerCounts, err := parseSteps(workerSteps)
+	if err != nil {
+		color.Red("ERROR: %s", err)
+		os.Exit(1)
+	}
+	bufferSizes, err := parseSteps(bufferSizeSteps)
+	if err != nil {
+		color.Red("ERROR: %s", err)
+		os.Exit(1)
+	}
+
+	files, err := listObjects(cmd.Context())
+	if err != nil {
+		color.Red("ERROR: Unable to list files from bucket: %s, directory: %s. Error: %s.", BucketName, strings.Join(bucketDirs, ","), err)
+		os.Exit(1)
+	}
+
+	header := []string{"Workers", "BufferSize (B)", "Ops", "Errors", "Ops/s", "Throughput (MB/s)", "p50 (ms)", "p90 (ms)", "p99 (ms)", "Max (ms)"}
+	rows := [][]string{header}
+
+	runDuration = stepDuration
+steps:
+	for _, b := range bufferSizes {
+		for _, w := range workerCounts {
+			bufferSize, numWorkers = uint64(b), w
+			color.Yellow(">>> Sweep step: [%d] workers, buffer size [%d] for [%s]", numWorkers, bufferSize, stepDuration)
+
+			out := runKeys(cmd.Context(), files, process)
+			summary := out.results.Summarize(out.duration)
+			rows = append(rows, []string{
+				strconv.Itoa(numWorkers),
+				strconv.FormatUint(bufferSize, 10),
+				strconv.Itoa(summary.Ops),
+				strconv.Itoa(summary.Failures),
+				fmt.Sprintf("%.1f", summary.OpsPerSec()),
+				fmt.Sprintf("%.1f", summary.ThroughputMBps()),
+				fmt.Sprintf("%.1f", millis(out.results.Percentile(50))),
+				fmt.Sprintf("%.1f", millis(out.results.Percentile(90))),
+				fmt.Sprintf("%.1f", millis(out.results.Percentile(99))),
+				fmt.Sprintf("%.1f", millis(out.results.Percentile(100))),
+			})
+
+			if out.interrupted {
+				color.Red(interruptedNote)
+				break steps
+			}
+		}
+	}
+
+	printTable("Sweep results", rows)
+}
+
+// printTable prints a table of rows to stdout and, with --output, also writes it as CSV.
+func printTable(title string, rows [][]string) {
+	color.Yellow("\n%s following\n", title)
+	color.Yellow(strings.Repeat("-", 90))
+	for _, row := range rows {
+		color.Green(strings.Join(row, "|"))
+	}
+	fmt.Println()
+
+	if OutputFile == "" {
+		return
+	}
+
+	f, err := os.Create(OutputFile)
+	if err != nil {
+		color.Red("Unable to write to [%s], err [%s].", OutputFile, err)
+		return
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	checkWriteErr(w.WriteAll(rows))
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSteps(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{spec: "1,4,16", want: []int{1, 4, 16}},
+		{spec: " 8 , 2", want: []int{8, 2}},
+		{spec: "32", want: []int{32}},
+		{spec: "1..64x2", want: []int{1, 2, 4, 8, 16, 32, 64}},
+		{spec: "3..100x3", want: []int{3, 9, 27, 81}},
+		{spec: "5..5x2", want: []int{5}},
+		{spec: "0,4", wantErr: true},
+		{spec: "1,x", wantErr: true},
+		{spec: "", wantErr: true},
+		{spec: "0..64x2", wantErr: true},
+		{spec: "1..64x1", wantErr: true},
+		{spec: "64..1x2", wantErr: true},
+		{spec: "1..64", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseSteps(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSteps(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSteps(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
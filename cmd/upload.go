@@ -86,56 +86,68 @@ func initUpload(cmd *cobra.Command, args []string) {
 
 	absDir := absDirPath(localdirname)
 
-	pool, _ := pool.NewPool(pool.Config{NumWorkers: numWorkers})
+	workerPool, _ := pool.NewPool(pool.Config{NumWorkers: numWorkers})
 	results := &report.Results{}
+	ctx := cmd.Context()
 
 	for _, localFileName := range localFileNames() {
-		ctx := context.Background()
-		var err error
-		var task func()
 		dirName := absDir
 		fileName := localFileName
-		task = func() {
+		task := func(w *pool.WorkerContext) error {
+			if ctx.Err() != nil {
+				// interrupted while queued, don't even start
+				return nil
+			}
+			taskCtx, cancel := requestContext(ctx, w)
+			defer cancel()
+			// uploads aren't retried, so their single attempt is the whole task
+			if requestTimeout > 0 {
+				var cancelTimeout context.CancelFunc
+				taskCtx, cancelTimeout = context.WithTimeout(taskCtx, requestTimeout)
+				defer cancelTimeout()
+			}
+
 			// ----- TaskFunc definition -------------------------------
-			err = processUpload(dirName, fileName, results)
+			return processTask(w, time.Time{}, func(results *report.Results) error { return processUpload(taskCtx, dirName, fileName, results) }, results)
 			// ---------------------------------------------------------
-
-			if err != nil {
-				color.Red("ERROR: ", err)
-			}
 		}
 
-		if err := pool.Add(ctx, task); err != nil {
+		if err := workerPool.Add(ctx, task); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			color.Red("ERROR: Adding item: %s", err)
 			os.Exit(1)
 		}
 	}
 
-	if err := pool.Wait(); err != nil {
+	if err := workerPool.Wait(); err != nil {
 		color.Red("ERROR: Closing: %s", err)
 	}
 
 	color.Green(">>> Threadpool exited\n\n")
 
 	duration := time.Since(startTime)
-	printResults(results, duration)
+	printResults(runOutcome{results: results, duration: duration, interrupted: ctx.Err() != nil, workers: workerPool.Stats()})
 }
 
-func processUpload(dirName string, fileName string, results *report.Results) error {
+func processUpload(ctx context.Context, dirName string, fileName string, results *report.Results) error {
 	path := fmt.Sprintf("%s/%s", destdir, fileName)
 
 	switch Provider {
 	case "dummy":
 		p := &providers.Dummy{
+			Options:       providerOptions,
 			Results:       results,
 			Key:           path,
 			LocalDirName:  dirName,
 			LocalFileName: fileName,
 		}
-		return p.Upload()
+		return p.Upload(ctx)
 	case "aws":
 		p := &providers.S3{
-			S3Client:      s3.New(providers.SetupS3Client(Region)),
+			Options:       providerOptions,
+			S3Client:      s3.New(providers.SetupS3Client(Region, providerOptions)),
 			Results:       results,
 			BucketName:    BucketName,
 			Key:           path,
@@ -143,9 +155,10 @@ func processUpload(dirName string, fileName string, results *report.Results) err
 			LocalFileName: fileName,
 			PartSize:      partsize,
 		}
-		return p.Upload()
+		return p.Upload(ctx)
 	case "gcp":
 		p := &providers.GCS{
+			Options:       providerOptions,
 			GCSClient:     providers.SetupGCSClient(),
 			Results:       results,
 			BucketName:    BucketName,
@@ -153,18 +166,19 @@ func processUpload(dirName string, fileName string, results *report.Results) err
 			LocalDirName:  dirName,
 			LocalFileName: fileName,
 		}
-		return p.Upload()
+		return p.Upload(ctx)
 	case "azure":
 		fmt.Printf("%s %s", readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"))
 		p := &providers.AZBlob{
-			ServiceURL:    providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY")),
+			Options:       providerOptions,
+			ServiceURL:    providers.SetupServiceURL(bufferSize, readEnvVar("AZURE_STORAGE_ACCOUNT"), readEnvVar("AZURE_STORAGE_KEY"), providerOptions),
 			Results:       results,
 			BucketName:    BucketName,
 			Key:           path,
 			LocalDirName:  dirName,
 			LocalFileName: fileName,
 		}
-		return p.Upload()
+		return p.Upload(ctx)
 	}
 	return fmt.Errorf("Unknown provider %s", Provider)
 }
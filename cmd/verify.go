@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/dliappis/blobbench/internal/providers"
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+var (
+	verify         bool
+	verifyManifest string
+)
+
+// readManifest reads the expected size and MD5 of objects from a keys file,
+// in any format readKeys supports.
+func readManifest(path string) (map[string]providers.Expected, error) {
+	objects, err := readKeys(path)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := map[string]providers.Expected{}
+	for _, obj := range objects {
+		manifest[obj.Key] = providers.Expected{Size: obj.Size, MD5: obj.MD5, Source: "manifest"}
+	}
+	return manifest, nil
+}
+
+// verificationSummary reports how many operations got their data verified
+// and what computing checksums cost.
+func verificationSummary(summary report.Summary) string {
+	if !verify {
+		return ""
+	}
+
+	line := fmt.Sprintf("\nVerified operations: [%d], integrity failures: [%d], hashing time (s): [%.1f]", summary.Verified, summary.Errors[report.ClassIntegrity], summary.HashTime.Seconds())
+	if summary.Busy > 0 {
+		line += fmt.Sprintf(", share of the duration of successful operations: [%.1f%%]", float64(summary.HashTime)*100/float64(summary.Busy))
+	}
+	return line
+}
@@ -0,0 +1,77 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Arrival processes supported by Pacer
+const (
+	ArrivalConstant = "constant"
+	ArrivalPoisson  = "poisson"
+)
+
+// Pacer computes the intended start times of tasks arriving at a target rate,
+// independently of when earlier tasks complete (open-loop).
+//
+type Pacer struct {
+	interval time.Duration
+	poisson  bool
+	rnd      *rand.Rand
+	next     time.Time
+}
+
+// NewPacer creates a new pacer issuing rate tasks per second, either at a
+// constant interval or following a Poisson process.
+//
+func NewPacer(rate float64, arrival string) (*Pacer, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("Rate must be positive, got [%f]", rate)
+	}
+
+	p := &Pacer{
+		interval: time.Duration(float64(time.Second) / rate),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	switch arrival {
+	case ArrivalConstant:
+	case ArrivalPoisson:
+		p.poisson = true
+	default:
+		return nil, fmt.Errorf("Unknown arrival process [%s], expected %s or %s", arrival, ArrivalConstant, ArrivalPoisson)
+	}
+	return p, nil
+}
+
+// Next waits until the intended start time of the next task and returns it.
+// When the caller has fallen behind schedule it returns immediately with a
+// time in the past, so that the delay shows up in the measured latency.
+// It returns an error if ctx is done before the intended start time.
+//
+func (p *Pacer) Next(ctx context.Context) (time.Time, error) {
+	now := time.Now()
+	if p.next.IsZero() {
+		p.next = now
+	}
+
+	intended := p.next
+	if p.poisson {
+		p.next = p.next.Add(time.Duration(p.rnd.ExpFloat64() * float64(p.interval)))
+	} else {
+		p.next = p.next.Add(p.interval)
+	}
+
+	if wait := intended.Sub(now); wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+			return intended, ctx.Err()
+		case <-t.C:
+		}
+	}
+	return intended, nil
+}
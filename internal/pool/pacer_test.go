@@ -0,0 +1,76 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewPacer(t *testing.T) {
+	tests := []struct {
+		rate    float64
+		arrival string
+		wantErr bool
+	}{
+		{10, ArrivalConstant, false},
+		{10, ArrivalPoisson, false},
+		{0, ArrivalConstant, true},
+		{-1, ArrivalConstant, true},
+		{10, "burst", true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewPacer(tt.rate, tt.arrival)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewPacer(%v, %q) error = %v, wantErr %v", tt.rate, tt.arrival, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPacerConstant(t *testing.T) {
+	p, _ := NewPacer(100, ArrivalConstant)
+
+	first, err := p.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		intended, err := p.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := intended.Sub(first), time.Duration(i)*10*time.Millisecond; got != want {
+			t.Errorf("task %d intended %s after the first, want %s", i, got, want)
+		}
+	}
+}
+
+func TestPacerBehindSchedule(t *testing.T) {
+	p, _ := NewPacer(1000, ArrivalConstant)
+	p.Next(context.Background())
+	time.Sleep(20 * time.Millisecond)
+
+	// a caller that fell behind gets start times in the past, without waiting
+	start := time.Now()
+	intended, err := p.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !intended.Before(start) {
+		t.Errorf("intended %s isn't before %s", intended, start)
+	}
+	if waited := time.Since(start); waited > 5*time.Millisecond {
+		t.Errorf("waited %s behind schedule", waited)
+	}
+}
+
+func TestPacerCanceled(t *testing.T) {
+	p, _ := NewPacer(0.1, ArrivalConstant)
+	p.Next(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Next(ctx); err != context.Canceled {
+		t.Errorf("Next() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -4,15 +4,20 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // Pool represents a worker pool
 //
 type Pool struct {
+	sync.Mutex
 	wg sync.WaitGroup
 
-	queue   chan TaskFunc
+	queue   chan queuedTask
 	workers []*Worker
+	// all contains removed workers too, for their stats
+	all    []*Worker
+	nextID int
 }
 
 // Config represents the pool configuration
@@ -26,15 +31,10 @@ type Config struct {
 func NewPool(cfg Config) (*Pool, error) {
 	fmt.Printf("==> Initializing pool with [%d] workers...\n", cfg.NumWorkers)
 	pool := Pool{
-		queue: make(chan TaskFunc, cfg.NumWorkers),
+		queue: make(chan queuedTask, cfg.NumWorkers),
 	}
 
-	for i := 1; i <= cfg.NumWorkers; i++ {
-		w := &Worker{id: i, ch: pool.queue, wg: &pool.wg}
-		pool.workers = append(pool.workers, w)
-		w.run()
-	}
-	pool.wg.Add(cfg.NumWorkers)
+	pool.AddWorkers(cfg.NumWorkers)
 
 	return &pool, nil
 }
@@ -45,11 +45,53 @@ func (pool *Pool) Add(ctx context.Context, task TaskFunc) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case pool.queue <- task:
+	case pool.queue <- queuedTask{fn: task, queued: time.Now()}:
 	}
 	return nil
 }
 
+// AddWorkers starts n more workers
+//
+func (pool *Pool) AddWorkers(n int) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	pool.wg.Add(n)
+	for i := 0; i < n; i++ {
+		pool.nextID++
+		w := &Worker{id: pool.nextID, ch: pool.queue, wg: &pool.wg, quit: make(chan struct{})}
+		w.stats.ID = w.id
+		pool.workers = append(pool.workers, w)
+		pool.all = append(pool.all, w)
+		w.run()
+	}
+}
+
+// RemoveWorkers stops the n most recently added workers, once they finish
+// their current task. At least one worker is always kept.
+//
+func (pool *Pool) RemoveWorkers(n int) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	if n > len(pool.workers)-1 {
+		n = len(pool.workers) - 1
+	}
+	for i := 0; i < n; i++ {
+		w := pool.workers[len(pool.workers)-1]
+		pool.workers = pool.workers[:len(pool.workers)-1]
+		close(w.quit)
+	}
+}
+
+// Size returns the current amount of workers
+//
+func (pool *Pool) Size() int {
+	pool.Lock()
+	defer pool.Unlock()
+	return len(pool.workers)
+}
+
 // Wait closes the pool queue and waits for goroutines to finish
 //
 func (pool *Pool) Wait() error {
@@ -58,12 +100,39 @@ func (pool *Pool) Wait() error {
 	return nil
 }
 
+// Stats returns the statistics of every worker that ever ran in the pool.
+// It must only be called after Wait.
+//
+func (pool *Pool) Stats() []WorkerStats {
+	pool.Lock()
+	defer pool.Unlock()
+
+	stats := make([]WorkerStats, len(pool.all))
+	for i, w := range pool.all {
+		stats[i] = w.stats
+	}
+	return stats
+}
+
+// WorkerStats contains statistics about the tasks a worker ran
+//
+type WorkerStats struct {
+	ID     int
+	Tasks  int
+	Errors int
+	Bytes  int64
+	Busy   time.Duration
+	Idle   time.Duration
+}
+
 // Worker represents a single worker
 //
 type Worker struct {
-	id int
-	ch <-chan TaskFunc
-	wg *sync.WaitGroup
+	id    int
+	ch    <-chan queuedTask
+	wg    *sync.WaitGroup
+	quit  chan struct{}
+	stats WorkerStats
 }
 
 func (w *Worker) run() {
@@ -71,13 +140,55 @@ func (w *Worker) run() {
 		fmt.Printf("--> [worker-%03d] Started\n", w.id)
 		defer w.wg.Done()
 
-		for taskFunc := range w.ch {
-			taskFunc()
-			fmt.Printf("--> [worker-%03d] Done\n", w.id)
+		idleSince := time.Now()
+		for {
+			select {
+			case <-w.quit:
+				w.stats.Idle += time.Since(idleSince)
+				fmt.Printf("--> [worker-%03d] Stopped\n", w.id)
+				return
+			case task, ok := <-w.ch:
+				if !ok {
+					w.stats.Idle += time.Since(idleSince)
+					return
+				}
+
+				start := time.Now()
+				w.stats.Idle += start.Sub(idleSince)
+
+				wc := &WorkerContext{ID: w.id, QueueWait: start.Sub(task.queued)}
+				err := task.fn(wc)
+
+				idleSince = time.Now()
+				w.stats.Busy += idleSince.Sub(start)
+				w.stats.Tasks++
+				w.stats.Bytes += wc.Bytes
+				if err != nil {
+					w.stats.Errors++
+					fmt.Printf("--> [worker-%03d] Error: %s\n", w.id, err)
+					continue
+				}
+				fmt.Printf("--> [worker-%03d] Done\n", w.id)
+			}
 		}
 	}()
 }
 
+// WorkerContext describes the worker running a task
+//
+type WorkerContext struct {
+	ID int
+	// QueueWait is how long the task waited in the queue for a worker
+	QueueWait time.Duration
+	// Bytes can be set by the task to the amount of bytes it moved
+	Bytes int64
+}
+
 // TaskFunc represents a worker task
 //
-type TaskFunc func()
+type TaskFunc func(w *WorkerContext) error
+
+type queuedTask struct {
+	fn     TaskFunc
+	queued time.Time
+}
@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRemoveWorkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		remove  int
+		want    int
+	}{
+		{"some", 5, 2, 3},
+		{"all but one", 5, 4, 1},
+		{"more than there are", 3, 10, 1},
+		{"none", 3, 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := NewPool(Config{NumWorkers: tt.workers})
+			p.RemoveWorkers(tt.remove)
+			if got := p.Size(); got != tt.want {
+				t.Errorf("Size() = %d, want %d", got, tt.want)
+			}
+
+			// the remaining workers still run tasks
+			var ran int32
+			for i := 0; i < 20; i++ {
+				p.Add(context.Background(), func(w *WorkerContext) error {
+					atomic.AddInt32(&ran, 1)
+					return nil
+				})
+			}
+			p.Wait()
+			if ran != 20 {
+				t.Errorf("ran %d tasks, want 20", ran)
+			}
+
+			// removed workers keep their stats
+			if got := len(p.Stats()); got != tt.workers {
+				t.Errorf("len(Stats()) = %d, want %d", got, tt.workers)
+			}
+		})
+	}
+}
+
+func TestRemoveWorkersThenAdd(t *testing.T) {
+	p, _ := NewPool(Config{NumWorkers: 4})
+	p.RemoveWorkers(2)
+	p.AddWorkers(3)
+	if got := p.Size(); got != 5 {
+		t.Errorf("Size() = %d, want 5", got)
+	}
+	p.Wait()
+
+	seen := map[int]bool{}
+	for _, s := range p.Stats() {
+		if seen[s.ID] {
+			t.Errorf("worker ID %d reused", s.ID)
+		}
+		seen[s.ID] = true
+	}
+}
@@ -1,8 +1,12 @@
 package providers
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,7 +17,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/s3manager"
-	"github.com/fatih/color"
 
 	"github.com/dliappis/blobbench/internal/report"
 )
@@ -30,13 +33,19 @@ type S3 struct {
 	LocalFileName string
 	PartSize      int64
 	Results       *report.Results
+	Options       Options
+	// Used only for in-memory puts
+	Body        []byte
+	IfNoneMatch bool
+	// Used only for downloads: what the listing or a keys file told about Key
+	Object ObjectInfo
 }
 
 // Upload copies a file to an S3 Bucket.
 // Path to the local file and S3 destination object are defined in p.
-func (p *S3) Upload() error {
+func (p *S3) Upload(ctx context.Context) error {
 	absFilePath := filepath.Join(p.LocalDirName, p.LocalFileName)
-	color.HiMagenta("DEBUG working on file [%s]", absFilePath)
+	p.Options.debugf("working on file [%s]", absFilePath)
 
 	uploader := s3manager.NewUploader(p.S3Client.Config)
 
@@ -47,10 +56,10 @@ func (p *S3) Upload() error {
 	defer f.Close()
 
 	// Upload the file to S3!
-	result, err := uploader.Upload(&s3manager.UploadInput{
+	result, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(p.BucketName),
 		Key:    aws.String(p.Key),
-		Body:   f,
+		Body:   limitReader(ctx, p.Options, f),
 	}, func(u *s3manager.Uploader) {
 		u.PartSize = p.PartSize
 	})
@@ -62,65 +71,197 @@ func (p *S3) Upload() error {
 	return nil
 }
 
-// Download ...
-func (p *S3) Download() error {
-	color.HiMagenta("DEBUG working on file [%s]", p.Key)
+// Put writes Body to an S3 object in a single PUT request.
+// When IfNoneMatch is set the object is only created if it doesn't exist already.
+func (p *S3) Put(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
 	m := report.MetricRecord{
 		File: p.Key,
+		Op:   report.OpPut,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		req := p.S3Client.PutObjectRequest(&s3.PutObjectInput{
+			Bucket: aws.String(p.BucketName),
+			Key:    aws.String(p.Key),
+			Body:   limitReadSeeker(ctx, p.Options, bytes.NewReader(p.Body)),
+		})
+		// saves the signer from reading the body, and the bandwidth limit with it
+		req.HTTPRequest.Header.Set("X-Amz-Content-Sha256", fmt.Sprintf("%x", sha256.Sum256(p.Body)))
+		if p.IfNoneMatch {
+			req.HTTPRequest.Header.Set("If-None-Match", "*")
+		}
+		_, err := req.Send(ctx)
+		return len(p.Body), err
+	})
+}
+
+// Download ...
+func (p *S3) Download(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
+	}
+
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset, -1)
+	})
+}
+
+// DownloadRange reads length bytes of an object, starting at offset.
+func (p *S3) DownloadRange(ctx context.Context, offset, length int64) error {
+	p.Options.debugf("working on file [%s], range [%d+%d]", p.Key, offset, length)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGetRange,
+		ObjectSize: p.Options.objectSize(p.Object),
+		Offset:     offset,
+		Length:     length,
 	}
 
-	mr := MeasuringReader{
-		Metric:       m,
-		BufferSize:   p.BufferSize,
-		Results:      p.Results,
-		ProcessError: p.processError,
-		Start:        time.Now(),
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, resume int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset+resume, length-resume)
+	})
+}
+
+// DownloadParallel reads a whole object split into parts ranges downloaded in parallel.
+func (p *S3) DownloadParallel(ctx context.Context, parts int) error {
+	p.Options.debugf("working on file [%s] in [%d] parts", p.Key, parts)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
 	}
 
-	req := p.S3Client.GetObjectRequest(&s3.GetObjectInput{
+	return measureParallel(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, parts, p.Size, p.openRange)
+}
+
+// openRange opens a stream of length bytes of an object starting at offset,
+// up to its end when length is negative.
+func (p *S3) openRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(p.BucketName),
 		Key:    aws.String(p.Key),
-	})
+	}
+	if length >= 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	req := p.S3Client.GetObjectRequest(input)
 
-	resp, err := req.Send(context.Background())
+	resp, err := req.Send(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = mr.ReadFrom(resp.Body)
-	if err != nil {
-		return err
+	size := int64(-1)
+	if resp.ContentLength != nil {
+		size = *resp.ContentLength
 	}
+	var sum []byte
+	// the ETag of objects encrypted with KMS or customer keys isn't their MD5
+	if input.Range == nil && resp.ServerSideEncryption != s3.ServerSideEncryptionAwsKms && resp.SSECustomerAlgorithm == nil {
+		sum = etagMD5(aws.StringValue(resp.ETag))
+	}
+	return verifyStream(ctx, p.Options, p.Object, offset, length, resp.Body, md5Check(size, sum, "ETag")), nil
+}
 
-	err = resp.Body.Close()
+// Size returns the size of an object, in bytes.
+func (p *S3) Size(ctx context.Context) (int64, error) {
+	req := p.S3Client.HeadObjectRequest(&s3.HeadObjectInput{
+		Bucket: aws.String(p.BucketName),
+		Key:    aws.String(p.Key),
+	})
+	resp, err := req.Send(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return aws.Int64Value(resp.ContentLength), nil
+}
 
-	return nil
+// Stat issues a HEAD request for an object, exercising a metadata-only call.
+func (p *S3) Stat(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpHead,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		req := p.S3Client.HeadObjectRequest(&s3.HeadObjectInput{
+			Bucket: aws.String(p.BucketName),
+			Key:    aws.String(p.Key),
+		})
+		_, err := req.Send(ctx)
+		return 0, err
+	})
+}
+
+// List times listing up to listPageSize objects under BucketDir.
+func (p *S3) List(ctx context.Context) error {
+	p.Options.debugf("listing [%s]", p.BucketDir)
+	m := report.MetricRecord{
+		File: p.BucketDir,
+		Op:   report.OpList,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		_, err := p.ListObjects(ctx, listPageSize)
+		return 0, err
+	})
+}
+
+// Delete removes an S3 object.
+func (p *S3) Delete(ctx context.Context) error {
+	p.Options.debugf("deleting file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpDelete,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		req := p.S3Client.DeleteObjectRequest(&s3.DeleteObjectInput{
+			Bucket: aws.String(p.BucketName),
+			Key:    aws.String(p.Key),
+		})
+		_, err := req.Send(ctx)
+		return 0, err
+	})
 }
 
 func (p *S3) processError(err error) report.MetricError {
 	// https://docs.aws.amazon.com/sdk-for-go/v1/developer-guide/handling-errors.html
-	if err, ok := err.(awserr.Error); ok {
-		return report.MetricError{Code: err.Code(), Message: err.Message()}
+	var e report.MetricError
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		e.Code, e.Message = aerr.Code(), aerr.Message()
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		e.Status = reqErr.StatusCode()
 	}
-	return report.MetricError{}
+	return e
 }
 
-// ListObjects returns all or the first numFiles objects of a bucket under a specified prefix
-func (p *S3) ListObjects(maxFiles int) ([]string, error) {
-	var files []string
+// ListObjects returns all or the first numFiles objects of a bucket under a specified prefix,
+// leaving out directory placeholders
+func (p *S3) ListObjects(ctx context.Context, maxFiles int) ([]ObjectInfo, error) {
+	var files []ObjectInfo
 
 	params := &s3.ListObjectsV2Input{
-		Bucket:    aws.String(p.BucketName),
-		Prefix:    aws.String(p.BucketDir),
-		Delimiter: aws.String("/"),
+		Bucket: aws.String(p.BucketName),
+		Prefix: aws.String(p.BucketDir),
+	}
+	if d := p.Options.delimiter(); d != "" {
+		params.Delimiter = aws.String(d)
 	}
 
 	for {
 		req := p.S3Client.ListObjectsV2Request(params)
-		result, err := req.Send(context.Background())
+		result, err := req.Send(ctx)
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
 				return nil, aerr
@@ -131,8 +272,17 @@ func (p *S3) ListObjects(maxFiles int) ([]string, error) {
 			if maxFiles != -1 && len(files)+1 > maxFiles {
 				return files, nil
 			}
+			if placeholder(aws.StringValue(obj.Key)) {
+				continue
+			}
 
-			files = append(files, *obj.Key)
+			files = append(files, ObjectInfo{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				ETag:         aws.StringValue(obj.ETag),
+				LastModified: aws.TimeValue(obj.LastModified),
+				StorageClass: string(obj.StorageClass),
+			})
 		}
 
 		if !*result.IsTruncated {
@@ -155,13 +305,17 @@ func baseCfg() aws.Config {
 }
 
 // SetupS3Client helper to setup the S3 client
-func SetupS3Client(region string) aws.Config {
+func SetupS3Client(region string, opts Options) aws.Config {
 	cfg := baseCfg()
 
+	if !opts.SDKRetries {
+		cfg.Retryer = aws.NoOpRetryer{}
+	}
+
 	// set the SDK region to either the one from the program arguments or else to the same region as the EC2 instance
 	cfg.Region = region
 
-	// set a 5-minute timeout for all S3 calls, including downloading the body
+	// set a 10-minute timeout for all S3 calls, including downloading the body
 	cfg.HTTPClient = &http.Client{
 		Timeout: time.Minute * 10,
 	}
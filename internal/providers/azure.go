@@ -1,7 +1,10 @@
 package providers
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -9,9 +12,7 @@ import (
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/dliappis/blobbench/internal/report"
-	"github.com/fatih/color"
 	"golang.org/x/net/context"
-	"google.golang.org/api/googleapi"
 )
 
 // AZBlob ...
@@ -23,16 +24,20 @@ type AZBlob struct {
 	Key           string
 	LocalDirName  string
 	LocalFileName string
+	Body          []byte
+	IfNoneMatch   bool
 	Results       *report.Results
+	Options       Options
+	// Used only for downloads: what the listing or a keys file told about Key
+	Object ObjectInfo
 }
 
 // Upload copies a file to an Azure Container (Bucket).
 // Path to the local file and Azure destination blob are defined in p.
-func (p *AZBlob) Upload() error {
+func (p *AZBlob) Upload(ctx context.Context) error {
 	absFilePath := filepath.Join(p.LocalDirName, p.LocalFileName)
-	color.HiMagenta("DEBUG working on file [%s]", absFilePath)
+	p.Options.debugf("working on file [%s]", absFilePath)
 
-	ctx := context.Background()
 	f, err := os.Open(filepath.Join(p.LocalDirName, p.LocalFileName))
 	if err != nil {
 		return err
@@ -51,61 +56,178 @@ func (p *AZBlob) Upload() error {
 		AccessConditions: azblob.BlobAccessConditions{},
 	}
 
-	_, err = azblob.UploadFileToBlockBlob(ctx, f, blobURL, uploadToBlockBlobOptions)
+	if len(limiters(ctx, p.Options)) > 0 {
+		// the file needs to be streamed through the bandwidth limits
+		_, err = azblob.UploadStreamToBlockBlob(ctx, limitReader(ctx, p.Options, f), blobURL, azblob.UploadStreamToBlockBlobOptions{
+			BufferSize:       int(uploadToBlockBlobOptions.BlockSize),
+			MaxBuffers:       2,
+			BlobHTTPHeaders:  uploadToBlockBlobOptions.BlobHTTPHeaders,
+			Metadata:         uploadToBlockBlobOptions.Metadata,
+			AccessConditions: uploadToBlockBlobOptions.AccessConditions,
+		})
+	} else {
+		_, err = azblob.UploadFileToBlockBlob(ctx, f, blobURL, uploadToBlockBlobOptions)
+	}
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// Download reads a blob from a container (bucket).
-func (p *AZBlob) Download() error {
-	color.HiMagenta("DEBUG working on file [%s]", p.Key)
+// Put writes Body to a block blob.
+// When IfNoneMatch is set the blob is only created if it doesn't exist already.
+func (p *AZBlob) Put(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
 	m := report.MetricRecord{
 		File: p.Key,
+		Op:   report.OpPut,
 	}
 
-	mr := MeasuringReader{
-		Metric:       m,
-		BufferSize:   p.BufferSize,
-		Results:      p.Results,
-		ProcessError: p.processError,
-		Start:        time.Now(),
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		blobURL := p.ServiceURL.NewContainerURL(p.BucketName).NewBlockBlobURL(p.Key)
+		conditions := azblob.BlobAccessConditions{}
+		if p.IfNoneMatch {
+			conditions.ModifiedAccessConditions.IfNoneMatch = azblob.ETagAny
+		}
+
+		_, err := blobURL.Upload(ctx, limitReadSeeker(ctx, p.Options, bytes.NewReader(p.Body)), azblob.BlobHTTPHeaders{}, azblob.Metadata{}, conditions)
+		return len(p.Body), err
+	})
+}
+
+// Download reads a blob from a container (bucket).
+func (p *AZBlob) Download(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
 	}
 
-	ctx := context.Background()
-	containerURL := p.ServiceURL.NewContainerURL(p.BucketName)
-	blobURL := containerURL.NewBlockBlobURL(p.Key)
-	get, err := blobURL.Download(ctx, 0, 0, azblob.BlobAccessConditions{}, false)
-	if err != nil {
-		return err
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset, azblob.CountToEnd)
+	})
+}
+
+// DownloadRange reads length bytes of a blob, starting at offset.
+func (p *AZBlob) DownloadRange(ctx context.Context, offset, length int64) error {
+	p.Options.debugf("working on file [%s], range [%d+%d]", p.Key, offset, length)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGetRange,
+		ObjectSize: p.Options.objectSize(p.Object),
+		Offset:     offset,
+		Length:     length,
 	}
 
-	reader := get.Body(azblob.RetryReaderOptions{})
-	_, err = mr.ReadFrom(reader)
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, resume int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset+resume, length-resume)
+	})
+}
+
+// DownloadParallel reads a whole blob split into parts ranges downloaded in parallel.
+func (p *AZBlob) DownloadParallel(ctx context.Context, parts int) error {
+	p.Options.debugf("working on file [%s] in [%d] parts", p.Key, parts)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
+	}
+
+	return measureParallel(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, parts, p.Size, p.openRange)
+}
+
+// openRange opens a stream of count bytes of a blob starting at offset
+func (p *AZBlob) openRange(ctx context.Context, offset, count int64) (io.ReadCloser, error) {
+	blobURL := p.ServiceURL.NewContainerURL(p.BucketName).NewBlockBlobURL(p.Key)
+	get, err := blobURL.Download(ctx, offset, count, azblob.BlobAccessConditions{}, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = reader.Close()
+	var sum []byte
+	length := count
+	if count == azblob.CountToEnd {
+		// CountToEnd is 0, where verifyStream takes up to the end as negative
+		length = -1
+		// Content-MD5 is only the checksum of the whole blob when all of it was requested
+		if offset == 0 {
+			sum = get.ContentMD5()
+		}
+	}
+	return verifyStream(ctx, p.Options, p.Object, offset, length, get.Body(azblob.RetryReaderOptions{}), md5Check(get.ContentLength(), sum, "Content-MD5")), nil
+}
+
+// Size returns the size of a blob, in bytes.
+func (p *AZBlob) Size(ctx context.Context) (int64, error) {
+	blobURL := p.ServiceURL.NewContainerURL(p.BucketName).NewBlockBlobURL(p.Key)
+	props, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return props.ContentLength(), nil
+}
+
+// Stat fetches the properties of a blob, exercising a metadata-only call.
+func (p *AZBlob) Stat(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpHead,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		blobURL := p.ServiceURL.NewContainerURL(p.BucketName).NewBlobURL(p.Key)
+		_, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{})
+		return 0, err
+	})
+}
+
+// List times listing up to listPageSize objects under BucketDir.
+func (p *AZBlob) List(ctx context.Context) error {
+	p.Options.debugf("listing [%s]", p.BucketDir)
+	m := report.MetricRecord{
+		File: p.BucketDir,
+		Op:   report.OpList,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		_, err := p.ListObjects(ctx, listPageSize)
+		return 0, err
+	})
+}
+
+// Delete removes a blob, including its snapshots.
+func (p *AZBlob) Delete(ctx context.Context) error {
+	p.Options.debugf("deleting file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpDelete,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		blobURL := p.ServiceURL.NewContainerURL(p.BucketName).NewBlobURL(p.Key)
+		_, err := blobURL.Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+		return 0, err
+	})
 }
 
 func (p *AZBlob) processError(err error) report.MetricError {
-	if err, ok := err.(*googleapi.Error); ok {
-		return report.MetricError{Code: string(err.Code), Message: err.Body}
+	var serr azblob.StorageError
+	if errors.As(err, &serr) {
+		e := report.MetricError{Code: string(serr.ServiceCode()), Message: serr.Error()}
+		if resp := serr.Response(); resp != nil {
+			e.Status = resp.StatusCode
+		}
+		return e
 	}
 	return report.MetricError{}
 }
 
-// ListObjects returns all or the first numFiles objects of a bucket under a specified prefix
-func (p *AZBlob) ListObjects(maxFiles int) ([]string, error) {
-	var files []string
-
-	ctx := context.Background()
+// ListObjects returns all or the first numFiles objects of a bucket under a specified prefix,
+// leaving out directory placeholders
+func (p *AZBlob) ListObjects(ctx context.Context, maxFiles int) ([]ObjectInfo, error) {
+	var files []ObjectInfo
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
 	defer cancel()
@@ -114,22 +236,44 @@ func (p *AZBlob) ListObjects(maxFiles int) ([]string, error) {
 
 	for marker := (azblob.Marker{}); marker.NotDone(); {
 		// Get a result segment starting with the blob indicated by the current Marker.
-		listBlob, err := containerURL.ListBlobsHierarchySegment(ctx, marker, "/", azblob.ListBlobsSegmentOptions{
+		var blobs []azblob.BlobItem
+		options := azblob.ListBlobsSegmentOptions{
 			Prefix: p.BucketDir,
-		})
-		if err != nil {
-			return nil, err
 		}
-		// IMPORTANT: ListBlobs returns the start of the next segment; you MUST use this to get
-		// the next segment (after processing the current result segment).
-		marker = listBlob.NextMarker
+		if p.Options.Recursive {
+			listBlob, err := containerURL.ListBlobsFlatSegment(ctx, marker, options)
+			if err != nil {
+				return nil, err
+			}
+			// IMPORTANT: ListBlobs returns the start of the next segment; you MUST use this to get
+			// the next segment (after processing the current result segment).
+			marker, blobs = listBlob.NextMarker, listBlob.Segment.BlobItems
+		} else {
+			listBlob, err := containerURL.ListBlobsHierarchySegment(ctx, marker, "/", options)
+			if err != nil {
+				return nil, err
+			}
+			marker, blobs = listBlob.NextMarker, listBlob.Segment.BlobItems
+		}
 
 		// Process the blobs returned in this result segment (if the segment is empty, the loop body won't execute)
-		for _, blobInfo := range listBlob.Segment.BlobItems {
+		for _, blobInfo := range blobs {
 			if maxFiles != -1 && len(files)+1 > maxFiles {
 				return files, nil
 			}
-			files = append(files, blobInfo.Name)
+			if placeholder(blobInfo.Name) {
+				continue
+			}
+			info := ObjectInfo{
+				Key:          blobInfo.Name,
+				ETag:         string(blobInfo.Properties.Etag),
+				LastModified: blobInfo.Properties.LastModified,
+				StorageClass: string(blobInfo.Properties.AccessTier),
+			}
+			if blobInfo.Properties.ContentLength != nil {
+				info.Size = *blobInfo.Properties.ContentLength
+			}
+			files = append(files, info)
 		}
 	}
 
@@ -137,13 +281,17 @@ func (p *AZBlob) ListObjects(maxFiles int) ([]string, error) {
 }
 
 // SetupServiceURL helper to setup the Azure request pipeline
-func SetupServiceURL(bufferSize uint64, accountName string, accountKey string) azblob.ServiceURL {
+func SetupServiceURL(bufferSize uint64, accountName string, accountKey string, opts Options) azblob.ServiceURL {
 	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
 	if err != nil {
 		panic(fmt.Sprintf("Unable to create Azure client with provided credentials. Error %s", err))
 	}
 
-	p := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	pipelineOptions := azblob.PipelineOptions{}
+	if !opts.SDKRetries {
+		pipelineOptions.Retry.MaxTries = 1
+	}
+	p := azblob.NewPipeline(credential, pipelineOptions)
 
 	u, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net", accountName))
 
@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Modes of a Consumer
+const (
+	// ThinkFixed pauses for a fixed time
+	ThinkFixed = "fixed"
+	// ThinkRandom pauses for a random time
+	ThinkRandom = "random"
+	// ThinkSHA256 hashes the data, like a checksum verification would
+	ThinkSHA256 = "sha256"
+	// ThinkCompress compresses the data, as a stand-in for codec work such as decompression
+	ThinkCompress = "compress"
+)
+
+// Consumer models an application that processes downloaded data, either
+// pausing after every Every bytes or doing CPU-bound work on all of them.
+type Consumer struct {
+	Mode string
+	// Every is the amount of bytes processed at once by the pausing modes, 0 means after every read
+	Every int
+	// Time is the pause of the fixed mode and the longest pause of the random one
+	Time time.Duration
+	// Passes is how many times the CPU-bound modes process the data
+	Passes int
+}
+
+// NewConsumer creates a new Consumer, checking its settings.
+func NewConsumer(mode string, every int, d time.Duration, passes int) (*Consumer, error) {
+	switch mode {
+	case ThinkFixed, ThinkRandom:
+		if d <= 0 {
+			return nil, fmt.Errorf("Think mode [%s] requires a positive think time, got [%s]", mode, d)
+		}
+		if every < 0 {
+			return nil, fmt.Errorf("Think mode [%s] requires a non-negative amount of bytes between pauses, got [%d]", mode, every)
+		}
+	case ThinkSHA256, ThinkCompress:
+		if passes < 1 {
+			return nil, fmt.Errorf("Think mode [%s] requires at least one pass, got [%d]", mode, passes)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown think mode [%s], expected %s, %s, %s or %s", mode, ThinkFixed, ThinkRandom, ThinkSHA256, ThinkCompress)
+	}
+	return &Consumer{Mode: mode, Every: every, Time: d, Passes: passes}, nil
+}
+
+// stream returns a function consuming the reads of a single stream, adding
+// the time it spends to thinkTime.
+func (c *Consumer) stream(ctx context.Context, thinkTime *int64) func(p []byte) error {
+	var (
+		pending int
+		h       hash.Hash
+		fw      *flate.Writer
+	)
+
+	return func(p []byte) error {
+		start := time.Now()
+		defer func() { atomic.AddInt64(thinkTime, int64(time.Since(start))) }()
+
+		switch c.Mode {
+		case ThinkSHA256:
+			if h == nil {
+				h = sha256.New()
+			}
+			for i := 0; i < c.Passes; i++ {
+				h.Write(p)
+			}
+			return nil
+		case ThinkCompress:
+			if fw == nil {
+				fw, _ = flate.NewWriter(ioutil.Discard, flate.DefaultCompression)
+			}
+			for i := 0; i < c.Passes; i++ {
+				if _, err := fw.Write(p); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		pending += len(p)
+		for pending > 0 && pending >= c.Every {
+			pending -= c.Every
+			if c.Every == 0 {
+				pending = 0
+			}
+
+			d := c.Time
+			if c.Mode == ThinkRandom {
+				d = time.Duration(rand.Int63n(int64(c.Time) + 1))
+			}
+			if err := sleep(ctx, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -1,40 +1,73 @@
 package providers
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"time"
 
-	"github.com/fatih/color"
-
 	"github.com/dliappis/blobbench/internal/report"
 )
 
 // Dummy ...
 type Dummy struct {
 	Results       *report.Results
+	BucketDir     string
 	Key           string
 	LocalDirName  string
 	LocalFileName string
+	Body          []byte
+	Options       Options
+	BufferSize    uint64
+	// Used only for downloads: what the listing or a keys file told about Key
+	Object ObjectInfo
 }
 
-// SleepingReader ...
-type SleepingReader struct{}
+// dummyObjectSize is the size of the made up objects of the dummy provider
+const dummyObjectSize = 1024 * 1024
+
+// SleepingReader waits up to 500ms and then delivers Size zero bytes
+type SleepingReader struct {
+	Ctx   context.Context
+	Size  int64
+	slept bool
+}
 
 func (r *SleepingReader) Read(p []byte) (int, error) {
-	// wait up to 500ms
-	time.Sleep(time.Millisecond * time.Duration(rand.Float32()*500))
-	return 0, io.EOF
+	if !r.slept {
+		r.slept = true
+		// wait up to 500ms
+		if err := sleep(r.Ctx, time.Millisecond*time.Duration(rand.Float32()*500)); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.Size <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	if int64(len(p)) > r.Size {
+		p = p[:r.Size]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	r.Size -= int64(len(p))
+	return len(p), nil
 }
 
 // Upload simulates upload of a file to a Blob store.
 // Local path is defined in p.
-func (p *Dummy) Upload() error {
+func (p *Dummy) Upload(ctx context.Context) error {
 	absFilePath := filepath.Join(p.LocalDirName, p.LocalFileName)
-	color.HiMagenta("DEBUG working on file [%s]", absFilePath)
+	p.Options.debugf("working on file [%s]", absFilePath)
 
 	_, err := os.Open(absFilePath)
 	if err != nil {
@@ -42,38 +75,159 @@ func (p *Dummy) Upload() error {
 	}
 
 	// wait up to 500ms
-	time.Sleep(time.Millisecond * time.Duration(rand.Float32()*500))
-	return nil
+	return sleep(ctx, time.Millisecond*time.Duration(rand.Float32()*500))
+}
+
+// Put simulates writing Body to a Blob store.
+func (p *Dummy) Put(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpPut,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		if _, err := io.Copy(ioutil.Discard, limitReader(ctx, p.Options, bytes.NewReader(p.Body))); err != nil {
+			return 0, err
+		}
+		// wait up to 100ms
+		return len(p.Body), sleep(ctx, time.Millisecond*time.Duration(rand.Float32()*100))
+	})
 }
 
 // Download ...
-func (p *Dummy) Download() error {
-	color.HiMagenta("DEBUG working on file [%s]", p.Key)
-	var err error
+func (p *Dummy) Download(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
+	}
+
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset, -1)
+	})
+}
+
+// DownloadRange simulates reading length bytes of an object, starting at offset.
+func (p *Dummy) DownloadRange(ctx context.Context, offset, length int64) error {
+	p.Options.debugf("working on file [%s], range [%d+%d]", p.Key, offset, length)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGetRange,
+		ObjectSize: p.Options.objectSize(p.Object),
+		Offset:     offset,
+		Length:     length,
+	}
+
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, resume int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset+resume, length-resume)
+	})
+}
+
+// DownloadParallel simulates reading a whole object split into parts ranges downloaded in parallel.
+func (p *Dummy) DownloadParallel(ctx context.Context, parts int) error {
+	p.Options.debugf("working on file [%s] in [%d] parts", p.Key, parts)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
+	}
+
+	return measureParallel(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, parts, p.Size, p.openRange)
+}
+
+// openRange simulates a stream of length bytes of an object starting at
+// offset, up to its end when length is negative.
+func (p *Dummy) openRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	size := length
+	if size < 0 {
+		size = dummyObjectSize - offset
+	}
+	body := ioutil.NopCloser(&SleepingReader{Ctx: ctx, Size: size})
+	return verifyStream(ctx, p.Options, p.Object, offset, length, body, check{size: size}), nil
+}
+
+// Size returns the size of the made up objects.
+func (p *Dummy) Size(ctx context.Context) (int64, error) {
+	return dummyObjectSize, nil
+}
+
+// Stat simulates a metadata-only call.
+func (p *Dummy) Stat(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
 	m := report.MetricRecord{
 		File: p.Key,
+		Op:   report.OpHead,
 	}
 
-	mr := MeasuringReader{
-		Metric:       m,
-		BufferSize:   0,
-		Results:      p.Results,
-		ProcessError: p.processError,
-		Start:        time.Now(),
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		// wait up to 50ms
+		return 0, sleep(ctx, time.Millisecond*time.Duration(rand.Float32()*50))
+	})
+}
+
+// List times listing up to listPageSize objects under BucketDir.
+func (p *Dummy) List(ctx context.Context) error {
+	p.Options.debugf("listing [%s]", p.BucketDir)
+	m := report.MetricRecord{
+		File: p.BucketDir,
+		Op:   report.OpList,
 	}
 
-	_, err = mr.ReadFrom(&SleepingReader{})
-	if err != nil {
-		return err
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		// wait up to 100ms
+		if err := sleep(ctx, time.Millisecond*time.Duration(rand.Float32()*100)); err != nil {
+			return 0, err
+		}
+		_, err := p.ListObjects(ctx, listPageSize)
+		return 0, err
+	})
+}
+
+// Delete removes a simulated object.
+func (p *Dummy) Delete(ctx context.Context) error {
+	p.Options.debugf("deleting file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpDelete,
 	}
 
-	return nil
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		// wait up to 50ms
+		return 0, sleep(ctx, time.Millisecond*time.Duration(rand.Float32()*50))
+	})
 }
 
 func (p *Dummy) processError(err error) report.MetricError {
-	if err != nil {
-		rand.Seed(time.Now().UnixNano())
-		return report.MetricError{Code: string(rand.Intn(500) + 1), Message: "Dummy provider error"}
-	}
+	// the dummy provider only fails when cancelled or timed out, which
+	// describeError classifies without any provider specific details
 	return report.MetricError{}
 }
+
+// ListObjects returns all or the first numFiles of 100 made up object names under a specified prefix,
+// and of 100 more in nested directories when listing recursively
+func (p *Dummy) ListObjects(ctx context.Context, maxFiles int) ([]ObjectInfo, error) {
+	var names []string
+	for i := 0; i < 100; i++ {
+		names = append(names, fmt.Sprintf("%sfile-%04d", p.BucketDir, i))
+	}
+	if p.Options.Recursive {
+		for i := 100; i < 200; i++ {
+			names = append(names, fmt.Sprintf("%sdir-%02d/file-%04d", p.BucketDir, i%10, i))
+		}
+	}
+
+	var files []ObjectInfo
+	for _, name := range names {
+		if maxFiles != -1 && len(files)+1 > maxFiles {
+			return files, nil
+		}
+		files = append(files, ObjectInfo{
+			Key:  name,
+			Size: dummyObjectSize,
+		})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// throttlingCodes are the error codes providers use to signal that requests are being throttled
+var throttlingCodes = map[string]bool{
+	"SlowDown":          true, // S3
+	"rateLimitExceeded": true, // GCS
+	"ServerBusy":        true, // Azure
+}
+
+// notFoundCodes are the error codes providers use for missing objects or buckets
+var notFoundCodes = map[string]bool{
+	"NoSuchKey":         true, // S3 GET
+	"NotFound":          true, // S3 HEAD
+	"NoSuchBucket":      true, // S3
+	"ObjectNotExist":    true, // GCS
+	"BucketNotExist":    true, // GCS
+	"BlobNotFound":      true, // Azure
+	"ContainerNotFound": true, // Azure
+}
+
+// authCodes are the error codes providers use for rejected credentials or permissions
+var authCodes = map[string]bool{
+	"AccessDenied":                    true, // S3
+	"InvalidAccessKeyId":              true, // S3
+	"SignatureDoesNotMatch":           true, // S3
+	"ExpiredToken":                    true, // S3
+	"forbidden":                       true, // GCS
+	"AuthenticationFailed":            true, // Azure
+	"AuthorizationFailure":            true, // Azure
+	"AuthorizationPermissionMismatch": true, // Azure
+}
+
+// serverErrorCodes are provider error codes that signal a failure on the server side
+var serverErrorCodes = map[string]bool{
+	"InternalError":      true, // S3, Azure
+	"ServiceUnavailable": true, // S3
+	"backendError":       true, // GCS
+}
+
+// integrityCodes are the error codes providers use when data doesn't match its checksum
+var integrityCodes = map[string]bool{
+	"BadCRC": true, // GCS, checked by its client
+}
+
+// describeError returns the details of err as reported by the provider
+// through processError, completed with the message and the class of err.
+func describeError(err error, processError func(err error) report.MetricError) report.MetricError {
+	e := processError(err)
+	if e.Message == "" {
+		e.Message = err.Error()
+	}
+	e.Class = classify(err, e)
+	return e
+}
+
+// classify returns the class of err, based on its details e as returned by processError.
+func classify(err error, e report.MetricError) string {
+	switch {
+	case throttlingCodes[e.Code] || e.Status == http.StatusTooManyRequests:
+		return report.ClassThrottled
+	// providers answer 503 both to slow clients down and when they fail, the
+	// code tells them apart when there is one
+	case serverErrorCodes[e.Code]:
+		return report.ClassServerError
+	case e.Status == http.StatusServiceUnavailable:
+		return report.ClassThrottled
+	case notFoundCodes[e.Code] || e.Status == http.StatusNotFound:
+		return report.ClassNotFound
+	case authCodes[e.Code] || e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden:
+		return report.ClassAuth
+	case integrityCodes[e.Code] || errors.Is(err, ErrIntegrity):
+		return report.ClassIntegrity
+	case errors.Is(err, context.Canceled):
+		return report.ClassCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrFirstByteTimeout), errors.Is(err, ErrStalled):
+		return report.ClassTimeout
+	}
+
+	if e.Status >= 500 {
+		return report.ClassServerError
+	}
+	// the provider responded, so the connection itself was fine
+	if e.Status != 0 {
+		return report.ClassOther
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return report.ClassTimeout
+	}
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || e.Code == "RequestError" {
+		return report.ClassConnection
+	}
+	return report.ClassOther
+}
@@ -0,0 +1,79 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	failed := errors.New("request failed")
+
+	tests := []struct {
+		name string
+		err  error
+		e    report.MetricError
+		want string
+	}{
+		{"S3 SlowDown", failed, report.MetricError{Code: "SlowDown", Status: 503}, report.ClassThrottled},
+		{"GCS rate limit", failed, report.MetricError{Code: "rateLimitExceeded", Status: 429}, report.ClassThrottled},
+		{"Azure ServerBusy", failed, report.MetricError{Code: "ServerBusy", Status: 503}, report.ClassThrottled},
+		{"429 without code", failed, report.MetricError{Status: 429}, report.ClassThrottled},
+		{"503 without code", failed, report.MetricError{Status: 503}, report.ClassThrottled},
+		{"S3 ServiceUnavailable", failed, report.MetricError{Code: "ServiceUnavailable", Status: 503}, report.ClassServerError},
+		{"S3 InternalError", failed, report.MetricError{Code: "InternalError", Status: 500}, report.ClassServerError},
+		{"GCS backendError", failed, report.MetricError{Code: "backendError", Status: 500}, report.ClassServerError},
+		{"502 without code", failed, report.MetricError{Status: 502}, report.ClassServerError},
+		{"S3 NoSuchKey", failed, report.MetricError{Code: "NoSuchKey", Status: 404}, report.ClassNotFound},
+		{"404 without code", failed, report.MetricError{Status: 404}, report.ClassNotFound},
+		{"Azure BlobNotFound", failed, report.MetricError{Code: "BlobNotFound"}, report.ClassNotFound},
+		{"S3 AccessDenied", failed, report.MetricError{Code: "AccessDenied", Status: 403}, report.ClassAuth},
+		{"401 without code", failed, report.MetricError{Status: 401}, report.ClassAuth},
+		{"GCS BadCRC", failed, report.MetricError{Code: "BadCRC"}, report.ClassIntegrity},
+		{"integrity check", fmt.Errorf("%w: read [1] bytes, expected [2]", ErrIntegrity), report.MetricError{}, report.ClassIntegrity},
+		{"canceled", fmt.Errorf("get: %w", context.Canceled), report.MetricError{}, report.ClassCanceled},
+		{"deadline", fmt.Errorf("get: %w", context.DeadlineExceeded), report.MetricError{}, report.ClassTimeout},
+		{"first byte timeout", ErrFirstByteTimeout, report.MetricError{}, report.ClassTimeout},
+		{"stalled", ErrStalled, report.MetricError{}, report.ClassTimeout},
+		{"net timeout", &net.OpError{Op: "read", Err: timeoutError{}}, report.MetricError{}, report.ClassTimeout},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), report.MetricError{}, report.ClassConnection},
+		{"unexpected EOF", io.ErrUnexpectedEOF, report.MetricError{}, report.ClassConnection},
+		{"S3 RequestError", failed, report.MetricError{Code: "RequestError"}, report.ClassConnection},
+		{"400 without code", failed, report.MetricError{Status: 400}, report.ClassOther},
+		{"unknown", failed, report.MetricError{}, report.ClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err, tt.e); got != tt.want {
+				t.Errorf("classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	err := errors.New("boom")
+	e := describeError(err, func(error) report.MetricError {
+		return report.MetricError{Code: "SlowDown", Status: 503}
+	})
+	if e.Message != "boom" {
+		t.Errorf("Message = %q, want %q", e.Message, "boom")
+	}
+	if e.Class != report.ClassThrottled {
+		t.Errorf("Class = %q, want %q", e.Class, report.ClassThrottled)
+	}
+}
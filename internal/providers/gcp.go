@@ -1,13 +1,16 @@
 package providers
 
 import (
+	"bytes"
+	"errors"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
-	"github.com/fatih/color"
 	"golang.org/x/net/context"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
@@ -24,16 +27,20 @@ type GCS struct {
 	Key           string
 	LocalDirName  string
 	LocalFileName string
+	Body          []byte
+	IfNoneMatch   bool
 	Results       *report.Results
+	Options       Options
+	// Used only for downloads: what the listing or a keys file told about Key
+	Object ObjectInfo
 }
 
 // Upload copies a file to a GCS Bucket.
 // Path to the local file and GCS destination object are defined in p.
-func (p *GCS) Upload() error {
+func (p *GCS) Upload(ctx context.Context) error {
 	absFilePath := filepath.Join(p.LocalDirName, p.LocalFileName)
-	color.HiMagenta("DEBUG working on file [%s]", absFilePath)
+	p.Options.debugf("working on file [%s]", absFilePath)
 
-	ctx := context.Background()
 	f, err := os.Open(filepath.Join(p.LocalDirName, p.LocalFileName))
 	if err != nil {
 		return err
@@ -41,7 +48,7 @@ func (p *GCS) Upload() error {
 	defer f.Close()
 
 	wc := p.GCSClient.Bucket(p.BucketName).Object(p.Key).NewWriter(ctx)
-	if _, err = io.Copy(wc, f); err != nil {
+	if _, err = io.Copy(wc, limitReader(ctx, p.Options, f)); err != nil {
 		return err
 	}
 	if err := wc.Close(); err != nil {
@@ -50,57 +57,171 @@ func (p *GCS) Upload() error {
 	return nil
 }
 
-// Download ...
-func (p *GCS) Download() error {
-	color.HiMagenta("DEBUG working on file [%s]", p.Key)
+// Put writes Body to a GCS object.
+// When IfNoneMatch is set the object is only created if it doesn't exist already.
+func (p *GCS) Put(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
 	m := report.MetricRecord{
 		File: p.Key,
+		Op:   report.OpPut,
 	}
 
-	mr := MeasuringReader{
-		Metric:       m,
-		BufferSize:   p.BufferSize,
-		Results:      p.Results,
-		ProcessError: p.processError,
-		Start:        time.Now(),
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		obj := p.GCSClient.Bucket(p.BucketName).Object(p.Key)
+		if p.IfNoneMatch {
+			obj = obj.If(storage.Conditions{DoesNotExist: true})
+		}
+
+		wc := obj.NewWriter(ctx)
+		if _, err := io.Copy(wc, limitReader(ctx, p.Options, bytes.NewReader(p.Body))); err != nil {
+			wc.Close()
+			return 0, err
+		}
+		return len(p.Body), wc.Close()
+	})
+}
+
+// Download ...
+func (p *GCS) Download(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
 	}
 
-	ctx := context.Background()
-	reader, err := p.GCSClient.Bucket(p.BucketName).Object(p.Key).NewReader(ctx)
-	if err != nil {
-		return err
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset, -1)
+	})
+}
+
+// DownloadRange reads length bytes of an object, starting at offset.
+func (p *GCS) DownloadRange(ctx context.Context, offset, length int64) error {
+	p.Options.debugf("working on file [%s], range [%d+%d]", p.Key, offset, length)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGetRange,
+		ObjectSize: p.Options.objectSize(p.Object),
+		Offset:     offset,
+		Length:     length,
+	}
+
+	return measureStream(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, func(ctx context.Context, resume int64) (io.ReadCloser, error) {
+		return p.openRange(ctx, offset+resume, length-resume)
+	})
+}
+
+// DownloadParallel reads a whole object split into parts ranges downloaded in parallel.
+func (p *GCS) DownloadParallel(ctx context.Context, parts int) error {
+	p.Options.debugf("working on file [%s] in [%d] parts", p.Key, parts)
+	m := report.MetricRecord{
+		File:       p.Key,
+		Op:         report.OpGet,
+		ObjectSize: p.Options.objectSize(p.Object),
 	}
 
-	_, err = mr.ReadFrom(reader)
+	return measureParallel(ctx, p.Options, p.Results, m, p.BufferSize, p.processError, parts, p.Size, p.openRange)
+}
+
+// openRange opens a stream of length bytes of an object starting at offset,
+// up to its end when length is negative. The client checks the CRC32C of
+// whole objects on its own.
+func (p *GCS) openRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	r, err := p.GCSClient.Bucket(p.BucketName).Object(p.Key).NewRangeReader(ctx, offset, length)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return verifyStream(ctx, p.Options, p.Object, offset, length, r, check{size: r.Remain()}), nil
+}
 
-	err = reader.Close()
+// Size returns the size of an object, in bytes.
+func (p *GCS) Size(ctx context.Context) (int64, error) {
+	attrs, err := p.GCSClient.Bucket(p.BucketName).Object(p.Key).Attrs(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return attrs.Size, nil
+}
+
+// Stat fetches the attributes of an object, exercising a metadata-only call.
+func (p *GCS) Stat(ctx context.Context) error {
+	p.Options.debugf("working on file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpHead,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		_, err := p.GCSClient.Bucket(p.BucketName).Object(p.Key).Attrs(ctx)
+		return 0, err
+	})
+}
+
+// List times listing up to listPageSize objects under BucketDir.
+func (p *GCS) List(ctx context.Context) error {
+	p.Options.debugf("listing [%s]", p.BucketDir)
+	m := report.MetricRecord{
+		File: p.BucketDir,
+		Op:   report.OpList,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		_, err := p.ListObjects(ctx, listPageSize)
+		return 0, err
+	})
+}
+
+// Delete removes a GCS object.
+func (p *GCS) Delete(ctx context.Context) error {
+	p.Options.debugf("deleting file [%s]", p.Key)
+	m := report.MetricRecord{
+		File: p.Key,
+		Op:   report.OpDelete,
+	}
+
+	return measure(ctx, p.Options, p.Results, m, p.processError, func(ctx context.Context) (int, error) {
+		err := p.GCSClient.Bucket(p.BucketName).Object(p.Key).Delete(ctx)
+		return 0, err
+	})
 }
 
 func (p *GCS) processError(err error) report.MetricError {
-	if err, ok := err.(*googleapi.Error); ok {
-		return report.MetricError{Code: string(err.Code), Message: err.Body}
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist):
+		return report.MetricError{Code: "ObjectNotExist", Status: http.StatusNotFound}
+	case errors.Is(err, storage.ErrBucketNotExist):
+		return report.MetricError{Code: "BucketNotExist", Status: http.StatusNotFound}
+	}
+
+	// the client reports CRC32C mismatches with an untyped error
+	if strings.HasPrefix(err.Error(), "storage: bad CRC") {
+		return report.MetricError{Code: "BadCRC"}
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		e := report.MetricError{Status: gerr.Code, Message: gerr.Message}
+		if len(gerr.Errors) > 0 {
+			e.Code = gerr.Errors[0].Reason
+		}
+		if e.Message == "" {
+			e.Message = gerr.Body
+		}
+		return e
 	}
 	return report.MetricError{}
 }
 
-// ListObjects returns all or the first numFiles objects of a bucket under a specified prefix
-func (p *GCS) ListObjects(maxFiles int) ([]string, error) {
-	var files []string
-
-	ctx := context.Background()
+// ListObjects returns all or the first numFiles objects of a bucket under a specified prefix,
+// leaving out directory placeholders
+func (p *GCS) ListObjects(ctx context.Context, maxFiles int) ([]ObjectInfo, error) {
+	var files []ObjectInfo
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
 	defer cancel()
 	it := p.GCSClient.Bucket(p.BucketName).Objects(ctx, &storage.Query{
 		Prefix:    p.BucketDir,
-		Delimiter: "/",
+		Delimiter: p.Options.delimiter(),
 	})
 
 	for {
@@ -115,7 +236,17 @@ func (p *GCS) ListObjects(maxFiles int) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, attrs.Name)
+		// prefixes of nested directories come without a name
+		if attrs.Prefix != "" || placeholder(attrs.Name) {
+			continue
+		}
+		files = append(files, ObjectInfo{
+			Key:          attrs.Name,
+			Size:         attrs.Size,
+			ETag:         attrs.Etag,
+			LastModified: attrs.Updated,
+			StorageClass: attrs.StorageClass,
+		})
 	}
 
 	return files, nil
@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// hedgeWindow is the amount of recent latencies a Hedger derives its delay from
+const hedgeWindow = 1000
+
+// hedgeMinSamples is the amount of latencies a Hedger needs before deriving its delay from them
+const hedgeMinSamples = 100
+
+// Hedger issues a duplicate of requests that didn't complete within a delay and
+// uses whichever of the two completes first, cancelling the other one.
+// It is safe to share it between workers.
+type Hedger struct {
+	// Delay before issuing the duplicate request. With a Percentile it is
+	// only used until enough latencies have been observed.
+	Delay time.Duration
+	// Percentile, when set, derives the delay from the observed latency of recent requests
+	Percentile float64
+
+	sync.Mutex
+	observed []time.Duration
+	seen     int
+	current  time.Duration
+}
+
+// NewHedger creates a new Hedger, hedging after delay or, when percentile is
+// set, after the observed percentile latency.
+func NewHedger(delay time.Duration, percentile float64) *Hedger {
+	return &Hedger{Delay: delay, Percentile: percentile, current: delay}
+}
+
+// delay returns the current hedging delay, false if there is none yet
+func (h *Hedger) delay() (time.Duration, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.current, h.current > 0
+}
+
+// observe records the latency d of a successful request
+func (h *Hedger) observe(d time.Duration) {
+	if h.Percentile <= 0 {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	if len(h.observed) < hedgeWindow {
+		h.observed = append(h.observed, d)
+	} else {
+		h.observed[h.seen%hedgeWindow] = d
+	}
+	h.seen++
+
+	// sorting the whole window on every request would be too expensive
+	if h.seen < hedgeMinSamples || h.seen%10 != 0 {
+		return
+	}
+
+	sorted := append([]time.Duration(nil), h.observed...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(h.Percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	h.current = sorted[rank-1]
+}
+
+// hedgeOutcome is the result of one of the requests of a hedged operation
+type hedgeOutcome struct {
+	size  int
+	err   error
+	hedge bool
+	took  time.Duration
+}
+
+// run runs op and, unless it completes within the hedging delay, a duplicate
+// of it. The first one to complete successfully wins and the other one gets
+// cancelled. It reports whether a duplicate was issued and whether it won.
+func (h *Hedger) run(ctx context.Context, op func(ctx context.Context) (int, error)) (size int, hedged bool, won bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan hedgeOutcome, 2)
+	launch := func(hedge bool) {
+		go func() {
+			start := time.Now()
+			size, err := op(ctx)
+			done <- hedgeOutcome{size: size, err: err, hedge: hedge, took: time.Since(start)}
+		}()
+	}
+
+	launch(false)
+	pending := 1
+
+	var timer <-chan time.Time
+	if d, ok := h.delay(); ok {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		select {
+		case <-timer:
+			hedged = true
+			launch(true)
+			pending++
+		case o := <-done:
+			pending--
+			if o.err == nil {
+				h.observe(o.took)
+				return o.size, hedged, o.hedge, nil
+			}
+			// failures are left to retries, unless the other request may still succeed
+			if pending == 0 {
+				return o.size, hedged, false, o.err
+			}
+			timer = nil
+		}
+	}
+}
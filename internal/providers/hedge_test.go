@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgerRunPrimaryWins(t *testing.T) {
+	h := NewHedger(50*time.Millisecond, 0)
+	var calls int32
+
+	size, hedged, won, err := h.run(context.Background(), func(ctx context.Context) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		return 10, nil
+	})
+	if err != nil || size != 10 {
+		t.Fatalf("run() = %d, %v, want 10, nil", size, err)
+	}
+	if hedged || won {
+		t.Errorf("hedged = %t, won = %t, want neither", hedged, won)
+	}
+
+	// no duplicate gets issued once the delay passes either
+	time.Sleep(80 * time.Millisecond)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("op ran %d times, want 1", n)
+	}
+}
+
+func TestHedgerRunHedgeWins(t *testing.T) {
+	h := NewHedger(10*time.Millisecond, 0)
+	var calls int32
+	primaryErr := make(chan error, 1)
+
+	size, hedged, won, err := h.run(context.Background(), func(ctx context.Context) (int, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the primary request hangs until it gets cancelled
+			<-ctx.Done()
+			primaryErr <- ctx.Err()
+			return 0, ctx.Err()
+		}
+		return 20, nil
+	})
+	if err != nil || size != 20 {
+		t.Fatalf("run() = %d, %v, want 20, nil", size, err)
+	}
+	if !hedged || !won {
+		t.Errorf("hedged = %t, won = %t, want both", hedged, won)
+	}
+
+	select {
+	case err := <-primaryErr:
+		if err != context.Canceled {
+			t.Errorf("primary request ended with %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Error("primary request didn't get cancelled")
+	}
+}
+
+func TestHedgerRunBothFail(t *testing.T) {
+	h := NewHedger(10*time.Millisecond, 0)
+	var calls int32
+	errPrimary := errors.New("primary failed")
+	errHedge := errors.New("hedge failed")
+
+	_, hedged, won, err := h.run(context.Background(), func(ctx context.Context) (int, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(50 * time.Millisecond)
+			return 0, errPrimary
+		}
+		return 0, errHedge
+	})
+	// the failing hedge leaves the outcome to the primary request
+	if err != errPrimary {
+		t.Errorf("run() error = %v, want %v", err, errPrimary)
+	}
+	if !hedged || won {
+		t.Errorf("hedged = %t, won = %t, want hedged only", hedged, won)
+	}
+}
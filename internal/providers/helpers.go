@@ -1,33 +1,103 @@
 package providers
 
 import (
+	"context"
+	"errors"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fatih/color"
+
 	"github.com/dliappis/blobbench/internal/report"
 )
 
-// MeasuringReader ...
+// ErrFirstByteTimeout is returned when a stream doesn't deliver its first byte within the first-byte timeout
+var ErrFirstByteTimeout = errors.New("first byte timeout")
+
+// ErrStalled is returned when a stream delivers no bytes for longer than the stall timeout
+var ErrStalled = errors.New("stream stalled")
+
+// listPageSize is the amount of objects a single List operation asks for
+const listPageSize = 1000
+
+// Options contains settings that apply to all providers
+type Options struct {
+	Retry RetryPolicy
+	// RequestTimeout, when set, aborts every attempt of an operation that takes longer
+	RequestTimeout time.Duration
+	// SDKRetries leaves the retries built into the SDKs enabled. Not supported by GCS.
+	SDKRetries bool
+	// Hedger, when set, hedges GET requests
+	Hedger *Hedger
+	// FirstByteTimeout aborts streams that didn't deliver their first byte in time
+	FirstByteTimeout time.Duration
+	// StallTimeout aborts streams when no bytes arrive for this long between two reads
+	StallTimeout time.Duration
+	// StallResumes is the amount of times an aborted stream gets resumed from
+	// the last byte read, using a range request
+	StallResumes int
+	// ReadStats records the individual reads of downloads
+	ReadStats bool
+	// Bandwidth, when set, limits the rate of all transfers
+	Bandwidth *Limiter
+	// Consumer, when set, processes downloaded data the way a slow application would
+	Consumer *Consumer
+	// Verify checks the size and, where available, the checksum of downloads
+	Verify bool
+	// Recursive lists the objects in nested directories under BucketDir too
+	Recursive bool
+	// Debug prints every operation as it starts
+	Debug bool
+	// Objects holds what objects are expected to contain by key, as read from
+	// a manifest. It takes precedence over what objects got listed with.
+	Objects map[string]Expected
+}
+
+// debugf prints a debug line about an operation, when enabled
+func (opts Options) debugf(format string, a ...interface{}) {
+	if opts.Debug {
+		color.HiMagenta("DEBUG "+format, a...)
+	}
+}
+
+// MeasuringReader drains streams, counting the bytes read
 type MeasuringReader struct {
-	Metric       report.MetricRecord
-	BufferSize   uint64
-	Results      *report.Results
-	Start        time.Time
-	ProcessError func(err error) report.MetricError
+	BufferSize uint64
+	// OnRead, when set, gets called after every read with the amount of bytes read
+	OnRead func(n int)
+	// Wait, when set, blocks after every read until the bytes read may be
+	// passed on, e.g. to limit the bandwidth
+	Wait func(n int) error
+	// Consume, when set, processes the bytes of every read before the next one
+	Consume func(p []byte) error
 }
 
-// ReadFrom ...
+// ReadFrom reads r until EOF and returns the amount of bytes read
 func (m *MeasuringReader) ReadFrom(r io.Reader) (int64, error) {
 	var (
 		buf  = make([]byte, m.BufferSize)
-		size int
-		n    int
+		size int64
 	)
 
 	for {
 		n, err := r.Read(buf)
 
-		size += n
+		size += int64(n)
+		if m.OnRead != nil {
+			m.OnRead(n)
+		}
+		if m.Wait != nil && n > 0 {
+			if werr := m.Wait(n); werr != nil {
+				return size, werr
+			}
+		}
+		if m.Consume != nil && n > 0 {
+			if cerr := m.Consume(buf[:n]); cerr != nil {
+				return size, cerr
+			}
+		}
 
 		if err == io.EOF {
 			break
@@ -35,19 +105,282 @@ func (m *MeasuringReader) ReadFrom(r io.Reader) (int64, error) {
 
 		// if the streaming fails, exit
 		if err != nil {
-			m.Metric.Duration = -1
-			m.Metric.Size = size
-			m.Metric.Success = false
-			m.Metric.ErrDetails = m.ProcessError(err)
-			m.Results.Push(m.Metric)
-			return int64(n), err
+			return size, err
 		}
 	}
 
-	m.Metric.Duration = time.Since(m.Start)
-	m.Metric.Size = size
-	m.Metric.Success = true
-	m.Results.Push(m.Metric)
+	return size, nil
+}
+
+// measure times a single operation op, retried according to opts, and pushes
+// its outcome into results. op returns the amount of bytes it transferred, if any,
+// and gets the context of the attempt, limited to the request timeout of opts.
+// Every attempt counts in the duration; errors of attempts that got retried are
+// kept in the record as well.
+func measure(ctx context.Context, opts Options, results *report.Results, m report.MetricRecord, processError func(err error) report.MetricError, op func(ctx context.Context) (int, error)) error {
+	return measureRecord(ctx, opts, results, m, processError, func(ctx context.Context, _ *report.MetricRecord) (int, error) {
+		return op(ctx)
+	})
+}
+
+// measureRecord is like measure, for operations that add details to the record m.
+func measureRecord(ctx context.Context, opts Options, results *report.Results, m report.MetricRecord, processError func(err error) report.MetricError, op func(ctx context.Context, m *report.MetricRecord) (int, error)) error {
+	start := time.Now()
+	m.Start = start
+
+	var err error
+	for m.Attempts = 1; ; m.Attempts++ {
+		var size int
+		size, err = attempt(ctx, opts, &m, op)
+		m.Size = size
+		if err == nil {
+			break
+		}
+
+		m.ErrDetails = describeError(err, processError)
+		if m.Attempts >= opts.Retry.MaxAttempts || !opts.Retry.retryable(m.ErrDetails.Class) || ctx.Err() != nil {
+			break
+		}
+		m.AttemptErrors = append(m.AttemptErrors, m.ErrDetails)
+		if sleep(ctx, opts.Retry.backoff(m.Attempts)) != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		m.Duration = -1
+		m.Success = false
+		results.Push(m)
+		return err
+	}
+
+	m.Duration = time.Since(start)
+	m.Success = true
+	m.ErrDetails = report.MetricError{}
+	results.Push(m)
+
+	return nil
+}
+
+// attempt runs op once, within the request timeout of opts
+func attempt(ctx context.Context, opts Options, m *report.MetricRecord, op func(ctx context.Context, m *report.MetricRecord) (int, error)) (int, error) {
+	if opts.RequestTimeout <= 0 {
+		return op(ctx, m)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.RequestTimeout)
+	defer cancel()
+	return op(ctx, m)
+}
+
+// measureStream times opening a stream with open and reading it until the end,
+// like measure does for single operations. It gets hedged when opts has a Hedger.
+// open gets the offset to start reading the object from, which is only set
+// when resuming a stream that stalled.
+func measureStream(ctx context.Context, opts Options, results *report.Results, m report.MetricRecord, bufferSize uint64, processError func(err error) report.MetricError, open func(ctx context.Context, offset int64) (io.ReadCloser, error)) error {
+	return measureRecord(ctx, opts, results, m, processError, func(ctx context.Context, m *report.MetricRecord) (int, error) {
+		// every attempt gets its own counts, as the request that lost a hedged
+		// attempt may still be winding down during the next one. They are counted
+		// atomically, as hedged requests read concurrently.
+		var (
+			stalls, resumes int32
+			thinkTime       int64
+		)
+
+		// reads keeps the reads of the successful request, or of the first one
+		// to fail when none succeeded
+		var reads struct {
+			sync.Mutex
+			rec *readRecorder
+			ok  bool
+		}
+		keepReads := func(rec *readRecorder, err error) {
+			reads.Lock()
+			defer reads.Unlock()
+			if !reads.ok {
+				reads.rec, reads.ok = rec, err == nil
+			}
+		}
+
+		read := func(ctx context.Context) (int, error) {
+			mr := MeasuringReader{
+				BufferSize: bufferSize,
+				Wait:       limitWait(ctx, opts),
+			}
+			if opts.Consumer != nil {
+				mr.Consume = opts.Consumer.stream(ctx, &thinkTime)
+			}
+
+			var rec *readRecorder
+			if opts.ReadStats {
+				rec = newReadRecorder()
+				mr.OnRead = rec.observe
+				// neither waiting for bandwidth nor the consumer count in the gaps between reads
+				if wait := mr.Wait; wait != nil {
+					mr.Wait = func(n int) error {
+						start := time.Now()
+						defer func() { rec.pause(time.Since(start)) }()
+						return wait(n)
+					}
+				}
+				if consume := mr.Consume; consume != nil {
+					mr.Consume = func(p []byte) error {
+						start := time.Now()
+						defer func() { rec.pause(time.Since(start)) }()
+						return consume(p)
+					}
+				}
+			}
+
+			var size int64
+			for {
+				n, err := readWatched(ctx, opts, mr, size, open)
+				size += n
+				if !errors.Is(err, ErrStalled) && !errors.Is(err, ErrFirstByteTimeout) {
+					keepReads(rec, err)
+					return int(size), err
+				}
 
-	return int64(n), nil
+				stalls := atomic.AddInt32(&stalls, 1)
+				if int(stalls) > opts.StallResumes || ctx.Err() != nil {
+					keepReads(rec, err)
+					return int(size), err
+				}
+				atomic.AddInt32(&resumes, 1)
+			}
+		}
+
+		var verify verifyStats
+		ctx = withVerifyStats(ctx, &verify)
+		defer func() {
+			m.HashTime += time.Duration(atomic.LoadInt64(&verify.hashTime))
+			m.Verified = atomic.LoadInt32(&verify.verified) > 0
+			m.Stalls += int(atomic.LoadInt32(&stalls))
+			m.Resumes += int(atomic.LoadInt32(&resumes))
+			m.ThinkTime += time.Duration(atomic.LoadInt64(&thinkTime))
+
+			reads.Lock()
+			defer reads.Unlock()
+			if reads.rec != nil {
+				m.Reads = reads.rec.stats()
+			}
+		}()
+
+		if opts.Hedger == nil {
+			return read(ctx)
+		}
+
+		size, hedged, won, err := opts.Hedger.run(ctx, read)
+		m.Hedged = m.Hedged || hedged
+		m.HedgeWon = won
+		return size, err
+	})
+}
+
+// readWatched opens a stream at offset and reads it until the end, aborting it
+// when it hits the first-byte or the stall timeout of opts.
+func readWatched(ctx context.Context, opts Options, mr MeasuringReader, offset int64, open func(ctx context.Context, offset int64) (io.ReadCloser, error)) (int64, error) {
+	if opts.FirstByteTimeout <= 0 && opts.StallTimeout <= 0 {
+		return readStream(ctx, opts, mr, offset, open)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		aborted error
+		started bool
+	)
+	watchdog := time.AfterFunc(time.Hour, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		aborted = ErrFirstByteTimeout
+		if started {
+			aborted = ErrStalled
+		}
+		cancel()
+	})
+	watchdog.Stop()
+	if opts.FirstByteTimeout > 0 {
+		watchdog.Reset(opts.FirstByteTimeout)
+	}
+	defer watchdog.Stop()
+
+	observe := mr.OnRead
+	mr.OnRead = func(n int) {
+		if observe != nil {
+			observe(n)
+		}
+		if n == 0 {
+			return
+		}
+		mu.Lock()
+		started = true
+		mu.Unlock()
+
+		if opts.StallTimeout > 0 {
+			watchdog.Reset(opts.StallTimeout)
+		} else {
+			watchdog.Stop()
+		}
+	}
+
+	// neither waiting for bandwidth nor the time the consumer takes count
+	// against the stream
+	paused := func(f func() error) error {
+		watchdog.Stop()
+		err := f()
+		if opts.StallTimeout > 0 {
+			watchdog.Reset(opts.StallTimeout)
+		}
+		return err
+	}
+	if wait := mr.Wait; wait != nil {
+		mr.Wait = func(n int) error {
+			return paused(func() error { return wait(n) })
+		}
+	}
+	if consume := mr.Consume; consume != nil {
+		mr.Consume = func(p []byte) error {
+			return paused(func() error { return consume(p) })
+		}
+	}
+
+	n, err := readStream(ctx, opts, mr, offset, open)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if aborted != nil && err != nil {
+		return n, aborted
+	}
+	return n, err
+}
+
+// readStream opens a stream at offset and reads it with mr until the end
+func readStream(ctx context.Context, opts Options, mr MeasuringReader, offset int64, open func(ctx context.Context, offset int64) (io.ReadCloser, error)) (int64, error) {
+	r, err := open(ctx, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := mr.ReadFrom(r)
+	if err != nil {
+		r.Close()
+		return size, err
+	}
+	return size, r.Close()
+}
+
+// sleep waits for d or until ctx is done, whichever comes first
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket limiting the rate at which bytes get transferred.
+// It is safe to share it between workers.
+type Limiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a new Limiter letting through bytesPerSec bytes per
+// second, with bursts of up to a tenth of a second worth of bytes.
+func NewLimiter(bytesPerSec float64) *Limiter {
+	burst := bytesPerSec / 10
+	return &Limiter{rate: bytesPerSec, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait blocks until n bytes may get transferred, or ctx is done.
+// Transfers larger than the burst go into debt, which later ones pay back.
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	l.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	return sleep(ctx, delay)
+}
+
+type limiterKey struct{}
+
+// WithLimiter returns a copy of ctx carrying a limiter, e.g. the one of a
+// worker, that applies to all transfers made with the context on top of the
+// limiter of the Options.
+func WithLimiter(ctx context.Context, l *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// limiters returns the limiters that apply to transfers made with ctx
+func limiters(ctx context.Context, opts Options) []*Limiter {
+	var ls []*Limiter
+	if opts.Bandwidth != nil {
+		ls = append(ls, opts.Bandwidth)
+	}
+	if l, ok := ctx.Value(limiterKey{}).(*Limiter); ok && l != nil {
+		ls = append(ls, l)
+	}
+	return ls
+}
+
+// limitedReader reads from r no faster than its limiters allow
+type limitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for _, limiter := range l.limiters {
+		if werr := limiter.wait(l.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// limitedReadSeeker is a limitedReader that can also seek, as request bodies need to
+type limitedReadSeeker struct {
+	limitedReader
+	s io.Seeker
+}
+
+func (l *limitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return l.s.Seek(offset, whence)
+}
+
+// limitWait returns a function waiting until n more bytes may get transferred
+// according to the limiters of ctx and opts, nil when there are none. It can
+// be used as MeasuringReader.Wait.
+func limitWait(ctx context.Context, opts Options) func(n int) error {
+	ls := limiters(ctx, opts)
+	if len(ls) == 0 {
+		return nil
+	}
+	return func(n int) error {
+		for _, limiter := range ls {
+			if err := limiter.wait(ctx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// limitReader applies the limiters of ctx and opts to reading r
+func limitReader(ctx context.Context, opts Options, r io.Reader) io.Reader {
+	ls := limiters(ctx, opts)
+	if len(ls) == 0 {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, limiters: ls}
+}
+
+// limitReadSeeker applies the limiters of ctx and opts to reading rs
+func limitReadSeeker(ctx context.Context, opts Options, rs io.ReadSeeker) io.ReadSeeker {
+	ls := limiters(ctx, opts)
+	if len(ls) == 0 {
+		return rs
+	}
+	return &limitedReadSeeker{limitedReader: limitedReader{ctx: ctx, r: rs, limiters: ls}, s: rs}
+}
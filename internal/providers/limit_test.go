@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+func TestLimiterWait(t *testing.T) {
+	// 1MB/s with a burst of 100KB
+	l := NewLimiter(1000 * 1000)
+
+	start := time.Now()
+	if err := l.wait(context.Background(), 100*1000); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > 20*time.Millisecond {
+		t.Errorf("waited %s within the burst", waited)
+	}
+
+	// the bucket is empty now, 100KB more take 100ms
+	start = time.Now()
+	if err := l.wait(context.Background(), 100*1000); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 80*time.Millisecond || waited > 200*time.Millisecond {
+		t.Errorf("waited %s, want about 100ms", waited)
+	}
+}
+
+func TestLimiterWaitCanceled(t *testing.T) {
+	l := NewLimiter(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// far beyond the burst, so it has to wait
+	if err := l.wait(ctx, 10*1000); err != context.Canceled {
+		t.Errorf("wait() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	r := limitReader(context.Background(), Options{Bandwidth: NewLimiter(2 * 1000 * 1000)}, bytes.NewReader(make([]byte, 500*1000)))
+
+	start := time.Now()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 500*1000 {
+		t.Errorf("read %d bytes, want %d", len(data), 500*1000)
+	}
+	// 200KB of burst, 300KB at 2MB/s
+	if took := time.Since(start); took < 120*time.Millisecond || took > 400*time.Millisecond {
+		t.Errorf("took %s, want about 150ms", took)
+	}
+}
+
+func TestLimitedStreamDoesntStall(t *testing.T) {
+	// 100KB/s with a burst of 10KB, so that every further read of 10KB waits 100ms
+	opts := Options{
+		Retry:        RetryPolicy{MaxAttempts: 1},
+		Bandwidth:    NewLimiter(100 * 1000),
+		StallTimeout: 30 * time.Millisecond,
+		ReadStats:    true,
+	}
+	results := &report.Results{}
+	open := func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(make([]byte, 40*1000-offset))), nil
+	}
+
+	err := measureStream(context.Background(), opts, results, report.MetricRecord{}, 10*1000, func(err error) report.MetricError { return report.MetricError{} }, open)
+	if err != nil {
+		t.Fatalf("measureStream() error = %v", err)
+	}
+
+	m := results.Items()[0]
+	if m.Size != 40*1000 || m.Stalls != 0 {
+		t.Errorf("read %d bytes with %d stalls, want %d bytes without stalls", m.Size, m.Stalls, 40*1000)
+	}
+	// the waits for bandwidth aren't gaps of the stream
+	if m.Reads.LongestStall > 30*time.Millisecond {
+		t.Errorf("longest stall %s, want less than the waits for bandwidth", m.Reads.LongestStall)
+	}
+}
@@ -0,0 +1,35 @@
+package providers
+
+import (
+	"strings"
+	"time"
+)
+
+// ObjectInfo describes an object as returned by listings or read from a keys file
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	// StorageClass is the storage class of S3 and GCS objects and the access tier of Azure blobs
+	StorageClass string
+	// MD5 is the digest of the content when a keys file provides it
+	MD5 []byte
+	// Source names where the object got described, e.g. listing; empty when
+	// nothing is known about it
+	Source string
+}
+
+// placeholder reports whether key is a zero-byte object standing in for a
+// directory, as created by consoles and some tools
+func placeholder(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// delimiter returns the delimiter listings use, none when listing recursively
+func (opts Options) delimiter() string {
+	if opts.Recursive {
+		return ""
+	}
+	return "/"
+}
@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// partChunks is the amount of reads of a part buffered for the Consumer. A part
+// that is that far ahead of the one being consumed waits for it.
+const partChunks = 16
+
+// rangePart is one of the ranges of an object downloaded in parallel
+type rangePart struct {
+	offset int64
+	length int64
+	// chunks carries the reads of the part when a Consumer needs the bytes in
+	// order; it gets closed once the part is done
+	chunks chan []byte
+}
+
+// measureParallel times downloading a whole object in parts ranged requests
+// issued in parallel, like measure does for single operations. size looks up
+// the size of the object, unless m has its ObjectSize, and openRange opens a
+// stream of a range of it.
+// The parts are streamed to the Consumer of opts, if any, in order, buffering
+// at most partChunks reads of every part.
+func measureParallel(ctx context.Context, opts Options, results *report.Results, m report.MetricRecord, bufferSize uint64, processError func(err error) report.MetricError, parts int,
+	size func(ctx context.Context) (int64, error), openRange func(ctx context.Context, offset, length int64) (io.ReadCloser, error)) error {
+	m.Parts = parts
+
+	return measureRecord(ctx, opts, results, m, processError, func(ctx context.Context, m *report.MetricRecord) (int, error) {
+		var verify verifyStats
+		ctx = withVerifyStats(ctx, &verify)
+		defer func() {
+			m.HashTime += time.Duration(atomic.LoadInt64(&verify.hashTime))
+			m.Verified = atomic.LoadInt32(&verify.verified) > 0
+		}()
+
+		total := m.ObjectSize
+		if total == 0 {
+			var err error
+			if total, err = size(ctx); err != nil {
+				return 0, err
+			}
+		}
+
+		var (
+			stalls, resumes int32
+			thinkTime       int64
+		)
+		n, err := readParts(ctx, opts, bufferSize, total, parts, openRange, &stalls, &resumes, &thinkTime)
+		m.Stalls += int(stalls)
+		m.Resumes += int(resumes)
+		m.ThinkTime += time.Duration(thinkTime)
+		if err == nil && opts.Verify && n != total {
+			err = fmt.Errorf("%w: read [%d] bytes in [%d] parts, expected [%d]", ErrIntegrity, n, parts, total)
+		}
+		return int(n), err
+	})
+}
+
+// readParts reads total bytes split into parts ranges in parallel. Parts that
+// stall get resumed up to StallResumes times in total, as in measureStream.
+func readParts(ctx context.Context, opts Options, bufferSize uint64, total int64, parts int, openRange func(ctx context.Context, offset, length int64) (io.ReadCloser, error), stalls, resumes *int32, thinkTime *int64) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	partSize := (total + int64(parts) - 1) / int64(parts)
+	var ranges []*rangePart
+	for offset := int64(0); offset < total; offset += partSize {
+		length := partSize
+		if offset+length > total {
+			length = total - offset
+		}
+		ranges = append(ranges, &rangePart{offset: offset, length: length, chunks: make(chan []byte, partChunks)})
+	}
+
+	var (
+		wg       sync.WaitGroup
+		read     int64
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for _, part := range ranges {
+		wg.Add(1)
+		go func(part *rangePart) {
+			defer wg.Done()
+			defer close(part.chunks)
+
+			mr := MeasuringReader{
+				BufferSize: bufferSize,
+				Wait:       limitWait(ctx, opts),
+			}
+			if opts.Consumer != nil {
+				mr.Consume = func(p []byte) error {
+					// the reader reuses p for the next read
+					chunk := append([]byte(nil), p...)
+					select {
+					case part.chunks <- chunk:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+			}
+
+			var size int64
+			for {
+				n, err := readWatched(ctx, opts, mr, size, func(ctx context.Context, resume int64) (io.ReadCloser, error) {
+					return openRange(ctx, part.offset+resume, part.length-resume)
+				})
+				size += n
+				atomic.AddInt64(&read, n)
+				if err == nil {
+					return
+				}
+				if !errors.Is(err, ErrStalled) && !errors.Is(err, ErrFirstByteTimeout) ||
+					int(atomic.AddInt32(stalls, 1)) > opts.StallResumes || ctx.Err() != nil {
+					fail(err)
+					return
+				}
+				atomic.AddInt32(resumes, 1)
+			}
+		}(part)
+	}
+
+	if opts.Consumer != nil {
+		consume := opts.Consumer.stream(ctx, thinkTime)
+	parts:
+		for _, part := range ranges {
+			for chunk := range part.chunks {
+				if err := consume(chunk); err != nil {
+					fail(err)
+					break parts
+				}
+			}
+		}
+	}
+
+	wg.Wait()
+	return atomic.LoadInt64(&read), firstErr
+}
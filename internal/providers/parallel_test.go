@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// recordRanges wraps the openRange of a Dummy, recording the requested ranges
+// and failing the one starting at failAt, unless it is negative
+func recordRanges(failAt int64) (func(ctx context.Context, offset, length int64) (io.ReadCloser, error), func() [][2]int64) {
+	p := &Dummy{}
+	var (
+		mu        sync.Mutex
+		requested [][2]int64
+	)
+
+	openRange := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		mu.Lock()
+		requested = append(requested, [2]int64{offset, length})
+		mu.Unlock()
+		if offset == failAt {
+			return nil, errors.New("part failed")
+		}
+		return p.openRange(ctx, offset, length)
+	}
+	ranges := func() [][2]int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		sort.Slice(requested, func(i, j int) bool { return requested[i][0] < requested[j][0] })
+		return requested
+	}
+	return openRange, ranges
+}
+
+func TestReadParts(t *testing.T) {
+	consumer, err := NewConsumer(ThinkSHA256, 0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  Options
+		total int64
+		parts int
+		want  [][2]int64
+	}{
+		{
+			name:  "even parts",
+			total: dummyObjectSize,
+			parts: 4,
+			want:  [][2]int64{{0, 262144}, {262144, 262144}, {524288, 262144}, {786432, 262144}},
+		},
+		{
+			name:  "uneven last part",
+			total: dummyObjectSize,
+			parts: 3,
+			want:  [][2]int64{{0, 349526}, {349526, 349526}, {699052, 349524}},
+		},
+		{
+			name:  "more parts than bytes",
+			total: 3,
+			parts: 5,
+			want:  [][2]int64{{0, 1}, {1, 1}, {2, 1}},
+		},
+		{
+			name:  "streamed to a consumer",
+			opts:  Options{Consumer: consumer},
+			total: dummyObjectSize,
+			parts: 3,
+			want:  [][2]int64{{0, 349526}, {349526, 349526}, {699052, 349524}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openRange, ranges := recordRanges(-1)
+			var (
+				stalls, resumes int32
+				thinkTime       int64
+			)
+
+			n, err := readParts(context.Background(), tt.opts, 8192, tt.total, tt.parts, openRange, &stalls, &resumes, &thinkTime)
+			if err != nil {
+				t.Fatalf("readParts() error = %v", err)
+			}
+			if n != tt.total {
+				t.Errorf("read %d bytes, want %d", n, tt.total)
+			}
+			if got := ranges(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requested ranges %v, want %v", got, tt.want)
+			}
+			if tt.opts.Consumer != nil && thinkTime == 0 {
+				t.Error("the consumer didn't process any data")
+			}
+		})
+	}
+}
+
+func TestReadPartsFailingPart(t *testing.T) {
+	consumer, err := NewConsumer(ThinkSHA256, 0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []Options{{}, {Consumer: consumer}} {
+		openRange, _ := recordRanges(349526)
+		var (
+			stalls, resumes int32
+			thinkTime       int64
+		)
+
+		_, err := readParts(context.Background(), opts, 8192, dummyObjectSize, 3, openRange, &stalls, &resumes, &thinkTime)
+		if err == nil || err.Error() != "part failed" {
+			t.Errorf("readParts() error = %v, want the error of the failing part", err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// readRecorder captures the individual reads of a stream
+type readRecorder struct {
+	start time.Time
+	times []time.Time
+	sizes []int
+	// pauses holds the time the consumer spent before every read, pending
+	// what it spent since the last one
+	pauses  []time.Duration
+	pending time.Duration
+}
+
+func newReadRecorder() *readRecorder {
+	return &readRecorder{start: time.Now()}
+}
+
+// observe records a read of n bytes; it can be used as MeasuringReader.OnRead
+func (r *readRecorder) observe(n int) {
+	if n == 0 {
+		return
+	}
+	r.times = append(r.times, time.Now())
+	r.sizes = append(r.sizes, n)
+	r.pauses = append(r.pauses, r.pending)
+	r.pending = 0
+}
+
+// pause records time the consumer spent processing data, which doesn't
+// count in the gaps between reads
+func (r *readRecorder) pause(d time.Duration) {
+	r.pending += d
+}
+
+// stats summarizes the recorded reads
+func (r *readRecorder) stats() *report.ReadStats {
+	s := &report.ReadStats{
+		Reads:         len(r.sizes),
+		SizeHistogram: make([]int, len(report.ReadSizeBuckets)+1),
+	}
+	if s.Reads == 0 {
+		return s
+	}
+
+	sizes := append([]int(nil), r.sizes...)
+	sort.Ints(sizes)
+	s.ReadSizeP50, s.MaxReadSize = sizes[(len(sizes)-1)/2], sizes[len(sizes)-1]
+	for _, n := range r.sizes {
+		s.SizeHistogram[report.ReadSizeBucket(n)]++
+	}
+
+	first, last := r.times[0], r.times[len(r.times)-1]
+	s.FirstByte = first.Sub(r.start)
+
+	gaps := make([]time.Duration, 0, len(r.times)-1)
+	for i := 1; i < len(r.times); i++ {
+		gaps = append(gaps, r.times[i].Sub(r.times[i-1])-r.pauses[i])
+	}
+	if len(gaps) > 0 {
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		s.GapP50, s.GapP99 = gaps[(len(gaps)-1)/2], gaps[(len(gaps)-1)*99/100]
+		s.LongestStall = gaps[len(gaps)-1]
+	}
+
+	span := last.Sub(first)
+	if span <= 0 {
+		return s
+	}
+	bytes := make([]int, report.ThroughputSlices)
+	for i, t := range r.times {
+		slice := int(int64(t.Sub(first)) * report.ThroughputSlices / int64(span))
+		if slice == report.ThroughputSlices {
+			slice--
+		}
+		bytes[slice] += r.sizes[i]
+	}
+	sliceDuration := span.Seconds() / report.ThroughputSlices
+	for _, b := range bytes {
+		s.Throughput = append(s.Throughput, float64(b)/(1024*1024)/sliceDuration)
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// RetryPolicy controls how blobbench itself retries failed operations,
+// on top of or instead of the retries built into the SDKs.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum amount of attempts per operation, 1 disables retries
+	MaxAttempts int
+	// Backoff is the base delay before a retry, doubled on every attempt with full jitter
+	Backoff time.Duration
+	// MaxBackoff caps the delay before a retry
+	MaxBackoff time.Duration
+	// RetryOn contains the error classes that get retried
+	RetryOn []string
+}
+
+// retryableClasses are the error classes a RetryPolicy may retry on
+var retryableClasses = []string{report.ClassThrottled, report.ClassServerError, report.ClassTimeout, report.ClassConnection, report.ClassIntegrity}
+
+// ParseRetryOn parses a comma separated list of error classes to retry on.
+func ParseRetryOn(spec string) ([]string, error) {
+	var classes []string
+	for _, c := range strings.Split(spec, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		valid := false
+		for _, rc := range retryableClasses {
+			valid = valid || c == rc
+		}
+		if !valid {
+			return nil, fmt.Errorf("Unknown error class [%s], expected one of %s", c, strings.Join(retryableClasses, ", "))
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+func (r RetryPolicy) retryable(class string) bool {
+	for _, c := range r.RetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before retrying after the given attempt
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	d := r.Backoff << uint(attempt-1)
+	if d <= 0 || d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
@@ -0,0 +1,180 @@
+package providers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIntegrity is returned when downloaded data doesn't match the size or the
+// checksum reported for it
+var ErrIntegrity = errors.New("integrity check failed")
+
+// Expected describes the content of an object, as listed in a manifest
+// or by the provider
+type Expected struct {
+	// Size is the size of the object in bytes, -1 when unknown
+	Size int64
+	// MD5 is the digest of the content of the object, nil when unknown
+	MD5 []byte
+	// Source names where the expectations come from, e.g. listing
+	Source string
+}
+
+// expected returns what obj should contain: what the manifest in Objects
+// says about it or, if it isn't there, what it got described with
+func (opts Options) expected(obj ObjectInfo) (Expected, bool) {
+	if e, ok := opts.Objects[obj.Key]; ok {
+		return e, true
+	}
+	if obj.Source == "" {
+		return Expected{}, false
+	}
+	return Expected{Size: obj.Size, MD5: obj.MD5, Source: obj.Source}, true
+}
+
+// objectSize returns the expected size of obj, 0 when unknown
+func (opts Options) objectSize(obj ObjectInfo) int64 {
+	if e, ok := opts.expected(obj); ok && e.Size > 0 {
+		return e.Size
+	}
+	return 0
+}
+
+// check is what a single stream gets verified against
+type check struct {
+	// size is the amount of bytes the stream should deliver, -1 when unknown
+	size int64
+	// sum is the digest of the content, computed with newHash, nil when unknown
+	sum     []byte
+	newHash func() hash.Hash
+	// source names where sum comes from, e.g. ETag
+	source string
+	// listedSize is set when size comes from Expected, naming its source
+	listedSize string
+}
+
+func (c check) sizeSource() string {
+	if c.listedSize == "" {
+		return ""
+	}
+	return " by the " + c.listedSize
+}
+
+// md5Check returns a check of size bytes with the MD5 digest sum, if known
+func md5Check(size int64, sum []byte, source string) check {
+	c := check{size: size}
+	if len(sum) == md5.Size {
+		c.sum, c.newHash, c.source = sum, md5.New, source
+	}
+	return c
+}
+
+// etagMD5 returns the MD5 digest an S3 ETag holds, which is only the case
+// for objects that weren't uploaded in parts or encrypted with KMS or
+// customer keys.
+func etagMD5(etag string) []byte {
+	sum, err := hex.DecodeString(strings.Trim(etag, `"`))
+	if err != nil || len(sum) != md5.Size {
+		return nil
+	}
+	return sum
+}
+
+// verifyStats counts the checks done for an operation, atomically as hedged
+// requests and parallel ranges get verified concurrently
+type verifyStats struct {
+	verified int32
+	hashTime int64
+}
+
+type verifyStatsKey struct{}
+
+// withVerifyStats returns a copy of ctx that counts the checks of its streams in s
+func withVerifyStats(ctx context.Context, s *verifyStats) context.Context {
+	return context.WithValue(ctx, verifyStatsKey{}, s)
+}
+
+// verifyStream wraps the stream body of obj, opened at offset for length
+// bytes (up to the end when negative), to check it against c and what obj is
+// expected to contain once it is read until the end. Streams are returned as
+// is when opts don't enable verification.
+func verifyStream(ctx context.Context, opts Options, obj ObjectInfo, offset, length int64, body io.ReadCloser, c check) io.ReadCloser {
+	if !opts.Verify {
+		return body
+	}
+
+	if e, ok := opts.expected(obj); ok {
+		if e.Size >= 0 {
+			c.listedSize = e.Source
+			c.size = e.Size - offset
+			if length >= 0 && length < c.size {
+				c.size = length
+			}
+		}
+		if offset == 0 && length < 0 && e.MD5 != nil {
+			c = md5Check(c.size, e.MD5, e.Source)
+			c.listedSize = e.Source
+		}
+	}
+
+	v := &verifyingReader{ReadCloser: body, check: c}
+	if c.newHash != nil {
+		v.hash = c.newHash()
+	}
+	v.stats, _ = ctx.Value(verifyStatsKey{}).(*verifyStats)
+	return v
+}
+
+// verifyingReader checks the bytes read from a stream once it reaches EOF
+type verifyingReader struct {
+	io.ReadCloser
+	check check
+	hash  hash.Hash
+	read  int64
+	stats *verifyStats
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+
+	if r.hash != nil && n > 0 {
+		start := time.Now()
+		r.hash.Write(p[:n])
+		if r.stats != nil {
+			atomic.AddInt64(&r.stats.hashTime, int64(time.Since(start)))
+		}
+	}
+
+	if err == io.EOF {
+		if verr := r.verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+// verify compares what was read with the check, once the stream ended
+func (r *verifyingReader) verify() error {
+	if r.check.size >= 0 && r.read != r.check.size {
+		return fmt.Errorf("%w: read [%d] bytes, expected [%d]%s", ErrIntegrity, r.read, r.check.size, r.check.sizeSource())
+	}
+	if r.hash != nil {
+		if sum := r.hash.Sum(nil); string(sum) != string(r.check.sum) {
+			return fmt.Errorf("%w: checksum [%x] doesn't match the %s [%x]", ErrIntegrity, sum, r.check.source, r.check.sum)
+		}
+	}
+
+	if r.stats != nil && (r.check.size >= 0 || r.hash != nil) {
+		atomic.AddInt32(&r.stats.verified, 1)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestVerifyStream(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	sum := md5.Sum(content)
+	wrongSum := md5.Sum([]byte("something else"))
+
+	tests := []struct {
+		name     string
+		expected Expected
+		offset   int64
+		length   int64
+		body     []byte
+		wantErr  bool
+	}{
+		{"whole read", Expected{Size: 100, MD5: sum[:]}, 0, -1, content, false},
+		{"whole read with a wrong checksum", Expected{Size: 100, MD5: wrongSum[:]}, 0, -1, content, true},
+		{"whole read cut short", Expected{Size: 100}, 0, -1, content[:90], true},
+		{"whole read of unknown size", Expected{Size: -1, MD5: sum[:]}, 0, -1, content, false},
+		{"ranged read", Expected{Size: 100, MD5: wrongSum[:]}, 10, 20, content[10:30], false},
+		{"ranged read cut short", Expected{Size: 100}, 10, 20, content[10:25], true},
+		{"ranged read past the end", Expected{Size: 100}, 90, 20, content[90:], false},
+		{"resumed read", Expected{Size: 100, MD5: wrongSum[:]}, 40, -1, content[40:], false},
+		{"resumed read cut short", Expected{Size: 100}, 40, -1, content[40:90], true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Verify: true, Objects: map[string]Expected{"key": tt.expected}}
+			var stats verifyStats
+			ctx := withVerifyStats(context.Background(), &stats)
+
+			body := ioutil.NopCloser(bytes.NewReader(tt.body))
+			_, err := ioutil.ReadAll(verifyStream(ctx, opts, ObjectInfo{Key: "key"}, tt.offset, tt.length, body, check{size: -1}))
+			if tt.wantErr {
+				if !errors.Is(err, ErrIntegrity) {
+					t.Errorf("verifyStream() error = %v, want %v", err, ErrIntegrity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyStream() error = %v", err)
+			}
+			if stats.verified != 1 {
+				t.Errorf("verified = %d, want 1", stats.verified)
+			}
+		})
+	}
+}
+
+func TestVerifyStreamDescribedObject(t *testing.T) {
+	content := []byte("described by a listing")
+	opts := Options{Verify: true}
+
+	// without a manifest, the size obj got listed with is expected
+	obj := ObjectInfo{Key: "key", Size: int64(len(content)) + 1, Source: "listing"}
+	_, err := ioutil.ReadAll(verifyStream(context.Background(), opts, obj, 0, -1, ioutil.NopCloser(bytes.NewReader(content)), check{size: -1}))
+	if !errors.Is(err, ErrIntegrity) {
+		t.Errorf("verifyStream() error = %v, want %v", err, ErrIntegrity)
+	}
+
+	// nor is anything expected of objects that weren't described
+	obj = ObjectInfo{Key: "key", Size: -1}
+	if _, err := ioutil.ReadAll(verifyStream(context.Background(), opts, obj, 0, -1, ioutil.NopCloser(bytes.NewReader(content)), check{size: -1})); err != nil {
+		t.Errorf("verifyStream() error = %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package report
+
+import "time"
+
+// ReadSizeBuckets are the upper bounds, exclusive, of the buckets of the read
+// size histogram. The last bucket holds all larger reads.
+var ReadSizeBuckets = []int{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10}
+
+// ThroughputSlices is the amount of equal slices the life of a stream gets split into
+const ThroughputSlices = 10
+
+// ReadStats describes the individual reads of the stream of an operation
+type ReadStats struct {
+	// Reads is the amount of reads that returned data
+	Reads int
+	// SizeHistogram counts the reads per bucket of ReadSizeBuckets
+	SizeHistogram []int
+	ReadSizeP50   int
+	MaxReadSize   int
+	// FirstByte is the time from issuing the request to reading the first byte
+	FirstByte time.Duration
+	// GapP50 and GapP99 are percentiles of the time between two consecutive reads
+	GapP50 time.Duration
+	GapP99 time.Duration
+	// LongestStall is the longest time between two consecutive reads
+	LongestStall time.Duration
+	// Throughput contains the MB/s reached in each of ThroughputSlices slices
+	// of the time between the first and the last read
+	Throughput []float64
+}
+
+// ReadSizeBucket returns the index of the ReadSizeBuckets bucket n belongs to
+func ReadSizeBucket(n int) int {
+	for i, bound := range ReadSizeBuckets {
+		if n < bound {
+			return i
+		}
+	}
+	return len(ReadSizeBuckets)
+}
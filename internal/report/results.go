@@ -1,23 +1,109 @@
 package report
 
 import (
+	"math"
+	"sort"
 	"sync"
 	"time"
 )
 
+// Operation types a MetricRecord can refer to
+const (
+	OpGet      = "GET"
+	OpGetRange = "GET_RANGE"
+	OpHead     = "HEAD"
+	OpPut      = "PUT"
+	OpList     = "LIST"
+	OpDelete   = "DELETE"
+)
+
 // MetricRecord contains metric records for a specific invocation of processFile
 type MetricRecord struct {
 	Size       int // TODO change this to int64
 	File       string
+	Op         string
 	Duration   time.Duration
 	Success    bool
 	ErrDetails MetricError
+	// ScheduleLag is how late, compared to its intended start time, an
+	// open-loop operation actually started. It is included in Duration.
+	ScheduleLag time.Duration
+	Start       time.Time
+	// Worker is the id of the pool worker that ran the operation
+	Worker int
+	// QueueWait is how long the operation waited in the pool queue for a worker
+	QueueWait time.Duration
+	// Attempts is the amount of times the operation was tried
+	Attempts int
+	// AttemptErrors contains the errors of the attempts that got retried
+	AttemptErrors []MetricError
+	// Hedged is set when a duplicate request was issued for the operation
+	Hedged bool
+	// HedgeWon is set when the duplicate request completed first
+	HedgeWon bool
+	// Stalls is the amount of times the stream got aborted by the first-byte or stall timeout
+	Stalls int
+	// Resumes is the amount of range requests resuming the stream after a stall
+	Resumes int
+	// Reads describes the individual reads of the stream, when they were recorded
+	Reads *ReadStats
+	// ThinkTime is the time spent processing the downloaded data between reads
+	ThinkTime time.Duration
+	// Offset and Length are the byte range of range reads
+	Offset int64
+	Length int64
+	// Parts is the amount of ranges downloaded in parallel, 0 for single stream downloads
+	Parts int
+	// ObjectSize is the size of the downloaded object as listed, 0 when unknown
+	ObjectSize int64
+	// Verified is set when the size or the checksum of the downloaded data got checked and matched
+	Verified bool
+	// HashTime is the time spent computing checksums of the downloaded data
+	HashTime time.Duration
 }
 
+// Error classes a MetricError can belong to, the same for all providers
+const (
+	ClassThrottled   = "throttled"
+	ClassNotFound    = "not_found"
+	ClassAuth        = "auth"
+	ClassTimeout     = "timeout"
+	ClassConnection  = "connection"
+	ClassServerError = "server_error"
+	ClassCanceled    = "client_cancel"
+	ClassIntegrity   = "integrity"
+	ClassOther       = "other"
+)
+
+// ErrorClasses lists all error classes in the order they are reported
+var ErrorClasses = []string{ClassThrottled, ClassNotFound, ClassAuth, ClassTimeout, ClassConnection, ClassServerError, ClassCanceled, ClassIntegrity, ClassOther}
+
 // MetricError contains error records for a specific invocation of processFile
 type MetricError struct {
-	Code    string
+	// Code is the error code of the provider, e.g. SlowDown or BlobNotFound
+	Code string
+	// Status is the HTTP status of the response, 0 if there was none
+	Status  int
 	Message string
+	Class   string
+}
+
+// Throttled reports whether the error signals that the provider throttled the request
+func (e MetricError) Throttled() bool {
+	return e.Class == ClassThrottled
+}
+
+// throttled reports whether any attempt of m got throttled
+func (m MetricRecord) throttled() bool {
+	if m.ErrDetails.Throttled() {
+		return true
+	}
+	for _, e := range m.AttemptErrors {
+		if e.Throttled() {
+			return true
+		}
+	}
+	return false
 }
 
 // ByDuration implements sort.Interface based on the idx field and lets us sort MetricRecord slices
@@ -48,3 +134,160 @@ func (r *Results) Push(v MetricRecord) {
 	defer r.Unlock()
 	r.items = append(r.items, v)
 }
+
+// Percentile returns the p-th (0 < p <= 100) percentile of the durations of
+// all successful items, using the nearest-rank method.
+// It is safe to call it concurrently.
+func (r *Results) Percentile(p float64) time.Duration {
+	r.Lock()
+	defer r.Unlock()
+
+	var durations []time.Duration
+	for _, v := range r.items {
+		if v.Success {
+			durations = append(durations, v.Duration)
+		}
+	}
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	rank := int(math.Ceil(p / 100 * float64(len(durations))))
+	if rank < 1 {
+		rank = 1
+	}
+	return durations[rank-1]
+}
+
+// Ops returns the distinct operation types of all items, in order of first appearance.
+// It is safe to call it concurrently.
+func (r *Results) Ops() []string {
+	r.Lock()
+	defer r.Unlock()
+
+	var ops []string
+	seen := make(map[string]bool)
+	for _, v := range r.items {
+		if !seen[v.Op] {
+			seen[v.Op] = true
+			ops = append(ops, v.Op)
+		}
+	}
+	return ops
+}
+
+// Filter returns new Results containing only the items for which keep returns true.
+// It is safe to call it concurrently.
+func (r *Results) Filter(keep func(MetricRecord) bool) *Results {
+	r.Lock()
+	defer r.Unlock()
+
+	filtered := &Results{}
+	for _, v := range r.items {
+		if keep(v) {
+			filtered.items = append(filtered.items, v)
+		}
+	}
+	return filtered
+}
+
+// Summary aggregates the items of Results collected over a run
+type Summary struct {
+	Ops      int
+	Failures int
+	// Throttled is the amount of operations with at least one throttled attempt
+	Throttled int
+	// Errors counts the failed operations per error class
+	Errors map[string]int
+	// Retried is the amount of operations that needed more than one attempt
+	Retried int
+	// Retries is the amount of attempts beyond the first one
+	Retries int
+	// Hedged is the amount of operations that issued a duplicate request
+	Hedged int
+	// HedgeWins is the amount of operations where the duplicate request completed first
+	HedgeWins int
+	// Stalled is the amount of operations whose stream got aborted by a timeout at least once
+	Stalled int
+	// Stalls is the amount of times streams got aborted by a timeout
+	Stalls int
+	// Resumes is the amount of range requests resuming stalled streams
+	Resumes int
+	// ThinkTime is the time spent processing downloaded data
+	ThinkTime time.Duration
+	// Verified is the amount of operations whose data got verified
+	Verified int
+	// HashTime is the time spent computing checksums of downloaded data
+	HashTime time.Duration
+	// ListedBytes is the sum of the listed sizes of the objects of GET
+	// operations, ListedRead what was read of them, including by failed ones
+	ListedBytes uint64
+	ListedRead  uint64
+	// Busy is the sum of the durations of all successful operations
+	Busy     time.Duration
+	Bytes    uint64
+	Duration time.Duration
+}
+
+// Summarize aggregates all items, assuming they were collected over duration.
+// It is safe to call it concurrently.
+func (r *Results) Summarize(duration time.Duration) Summary {
+	r.Lock()
+	defer r.Unlock()
+
+	s := Summary{Ops: len(r.items), Duration: duration, Errors: map[string]int{}}
+	for _, v := range r.items {
+		s.Bytes += uint64(v.Size)
+		if !v.Success {
+			s.Failures++
+			s.Errors[v.ErrDetails.Class]++
+		}
+		if v.throttled() {
+			s.Throttled++
+		}
+		if v.Attempts > 1 {
+			s.Retried++
+			s.Retries += v.Attempts - 1
+		}
+		if v.Hedged {
+			s.Hedged++
+		}
+		if v.HedgeWon {
+			s.HedgeWins++
+		}
+		s.ThinkTime += v.ThinkTime
+		s.HashTime += v.HashTime
+		if v.Op == OpGet && v.ObjectSize > 0 {
+			s.ListedBytes += uint64(v.ObjectSize)
+			s.ListedRead += uint64(v.Size)
+		}
+		if v.Verified {
+			s.Verified++
+		}
+		if v.Success {
+			s.Busy += v.Duration
+		}
+		if v.Stalls > 0 {
+			s.Stalled++
+			s.Stalls += v.Stalls
+			s.Resumes += v.Resumes
+		}
+	}
+	return s
+}
+
+// Requests returns the amount of requests sent, including retries, hedges and resumes
+func (s Summary) Requests() int {
+	return s.Ops + s.Retries + s.Hedged + s.Resumes
+}
+
+// OpsPerSec returns the amount of operations per second
+func (s Summary) OpsPerSec() float64 {
+	return float64(s.Ops) / s.Duration.Seconds()
+}
+
+// ThroughputMBps returns the throughput in MB/s
+func (s Summary) ThroughputMBps() float64 {
+	return float64(s.Bytes) / ((float64(s.Duration) / float64(time.Millisecond)) * float64(1000))
+}
@@ -0,0 +1,87 @@
+package workload
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+// opNames maps the operation names accepted in a workload spec to report operation types
+var opNames = map[string]string{
+	"get":    report.OpGet,
+	"head":   report.OpHead,
+	"put":    report.OpPut,
+	"list":   report.OpList,
+	"delete": report.OpDelete,
+}
+
+// Mix assigns relative weights to operation types
+type Mix struct {
+	ops     []string
+	weights []int
+	total   int
+}
+
+// ParseMix parses a workload spec of comma separated op=weight pairs,
+// e.g. "get=70,put=20,list=5,delete=5".
+func ParseMix(spec string) (*Mix, error) {
+	m := &Mix{}
+	seen := make(map[string]bool)
+
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid workload entry [%s], expected op=weight", pair)
+		}
+
+		op, ok := opNames[strings.ToLower(kv[0])]
+		if !ok {
+			return nil, fmt.Errorf("Unknown operation [%s] in workload entry [%s]", kv[0], pair)
+		}
+		if seen[op] {
+			return nil, fmt.Errorf("Operation [%s] specified more than once", kv[0])
+		}
+		seen[op] = true
+
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("Invalid weight [%s] in workload entry [%s]", kv[1], pair)
+		}
+		if weight == 0 {
+			continue
+		}
+
+		m.ops = append(m.ops, op)
+		m.weights = append(m.weights, weight)
+		m.total += weight
+	}
+
+	if m.total == 0 {
+		return nil, fmt.Errorf("Workload [%s] has no operations with a positive weight", spec)
+	}
+	return m, nil
+}
+
+// Pick returns an operation type chosen randomly according to the weights of the mix.
+func (m *Mix) Pick(r *rand.Rand) string {
+	n := r.Intn(m.total)
+	for i, w := range m.weights {
+		if n < w {
+			return m.ops[i]
+		}
+		n -= w
+	}
+	return m.ops[len(m.ops)-1]
+}
+
+// String returns the mix as a percentage per operation type.
+func (m *Mix) String() string {
+	parts := make([]string, len(m.ops))
+	for i, op := range m.ops {
+		parts[i] = fmt.Sprintf("%s=%.1f%%", op, float64(m.weights[i])*100/float64(m.total))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,65 @@
+package workload
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/dliappis/blobbench/internal/report"
+)
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "get=70,put=20,list=5,delete=5", want: "GET=70.0%,PUT=20.0%,LIST=5.0%,DELETE=5.0%"},
+		{spec: "get=1", want: "GET=100.0%"},
+		{spec: " GET=3 , head=1", want: "GET=75.0%,HEAD=25.0%"},
+		{spec: "get=1,put=0", want: "GET=100.0%"},
+		{spec: "", wantErr: true},
+		{spec: "get", wantErr: true},
+		{spec: "get=", wantErr: true},
+		{spec: "get=x", wantErr: true},
+		{spec: "get=-1,put=2", wantErr: true},
+		{spec: "copy=1", wantErr: true},
+		{spec: "get=1,get=2", wantErr: true},
+		{spec: "get=0,put=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			m, err := ParseMix(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMix(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && m.String() != tt.want {
+				t.Errorf("ParseMix(%q) = %s, want %s", tt.spec, m, tt.want)
+			}
+		})
+	}
+}
+
+func TestMixPick(t *testing.T) {
+	m, err := ParseMix("get=3,put=1,delete=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	r := rand.New(rand.NewSource(1))
+	const picks = 40000
+	for i := 0; i < picks; i++ {
+		counts[m.Pick(r)]++
+	}
+
+	if counts[report.OpDelete] != 0 {
+		t.Errorf("picked %s [%d] times with weight 0", report.OpDelete, counts[report.OpDelete])
+	}
+	if share := float64(counts[report.OpGet]) / picks; share < 0.73 || share > 0.77 {
+		t.Errorf("%s share = %.3f, want about 0.75", report.OpGet, share)
+	}
+	if counts[report.OpGet]+counts[report.OpPut] != picks {
+		t.Errorf("picked other operations: %v", counts)
+	}
+}